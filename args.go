@@ -1,6 +1,8 @@
 package tagfunctions
 
 import (
+	"fmt"
+
 	"golang.org/x/net/html"
 )
 
@@ -36,9 +38,22 @@ func ToArgs(n *html.Node) []string {
 }
 
 // SetArg Set attribute argument by index
+//
+// It panics if the index is invalid, see TrySetArg.
 func SetArg(n *html.Node, i int, k string) {
+	if err := TrySetArg(n, i, k); err != nil {
+		panic(err)
+	}
+}
+
+// TrySetArg is SetArg, returning an error if the index is invalid
+func TrySetArg(n *html.Node, i int, k string) error {
+	if i < 0 || i >= len(n.Attr) {
+		return fmt.Errorf("SetArg: index %d out of range for node %s with %d args", i, n.Data, len(n.Attr))
+	}
 	n.Attr[i].Key = k
 	n.Attr[i].Val = ""
+	return nil
 }
 
 // GetArg - get Attribute value by index.
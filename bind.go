@@ -0,0 +1,171 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// BindArgs fills the struct pointed to by v from the arguments of n.
+//
+// Fields are matched with the "tf" struct tag:
+//
+//	Src   string        `tf:"0"`                   // first positional argument
+//	Alt   string        `tf:"1,required"`          // second positional argument, must be present
+//	Width int           `tf:"width,default=100"`   // named argument width=...
+//	Tags  []string      `tf:"tags"`                // tags=a,b,c
+//	Delay time.Duration `tf:"delay,default=1s"`
+//	Sizes []int         `tf:"sizes,default=1,2"`   // default is the rest of the tag
+//
+// Positional arguments are those without a value, and are numbered
+// from 0 in the order they appear, ignoring named arguments.
+// Supported field types are strings, ints, uints, floats, bools,
+// time.Duration and slices of those, with slice values separated by
+// commas.  Fields without a tag, or with a tag of "-", are ignored.
+func BindArgs(n *html.Node, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind: expected pointer to struct, got %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	var positional []string
+	named := make(map[string]string)
+	for _, attr := range n.Attr {
+		if attr.Val == "" {
+			positional = append(positional, attr.Key)
+			continue
+		}
+		named[attr.Key] = attr.Val
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("tf")
+		if !ok || tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		required := false
+		def, hasDefault := "", false
+		// default= is last, and its value may contain commas
+		if i := strings.Index(","+opts, ",default="); i != -1 {
+			def, hasDefault = opts[i+len("default="):], true
+			opts = opts[:max(i-1, 0)]
+		}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "":
+			case "required":
+				required = true
+			default:
+				return fmt.Errorf("bind: field %s: unknown tag option %q", field.Name, opt)
+			}
+		}
+
+		var val string
+		var found bool
+		label := fmt.Sprintf("%q", name)
+		if idx, err := strconv.Atoi(name); err == nil {
+			label = fmt.Sprintf("%d", idx)
+			if idx >= 0 && idx < len(positional) {
+				val, found = positional[idx], true
+			}
+		} else {
+			val, found = named[name]
+		}
+		if !found {
+			if required {
+				return fmt.Errorf("bind: argument %s: required", label)
+			}
+			if !hasDefault {
+				continue
+			}
+			val = def
+		}
+		if err := setField(rv.Field(i), val); err != nil {
+			return fmt.Errorf("bind: argument %s: %v", label, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(f reflect.Value, val string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to duration", val)
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to %s", val, f.Type())
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to %s", val, f.Type())
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(val, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to %s", val, f.Type())
+		}
+		f.SetFloat(x)
+	case reflect.Bool:
+		b, err := parseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Slice:
+		if val == "" {
+			f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+			return nil
+		}
+		parts := strings.Split(val, ",")
+		s := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setField(s.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
+
+// Func adapts a function taking typed arguments into a NodeFunc.
+// The arguments are filled in using BindArgs.
+//
+//	type imgArgs struct {
+//		Src   string `tf:"0,required"`
+//		Width int    `tf:"width,default=100"`
+//	}
+//	reg.Register("img", Func(func(n *html.Node, args imgArgs) error { ... }))
+func Func[T any](fn func(n *html.Node, args T) error) NodeFunc {
+	return func(n *html.Node) error {
+		var args T
+		if err := BindArgs(n, &args); err != nil {
+			return err
+		}
+		return fn(n, args)
+	}
+}
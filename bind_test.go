@@ -0,0 +1,114 @@
+package tagfunctions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+type bindTest struct {
+	Src    string        `tf:"0,required"`
+	Alt    string        `tf:"1"`
+	Width  int           `tf:"width,default=100"`
+	Ratio  float64       `tf:"ratio"`
+	Lazy   bool          `tf:"lazy"`
+	Delay  time.Duration `tf:"delay,default=1s"`
+	Sizes  []int         `tf:"sizes"`
+	Ignore string
+}
+
+func TestBindArgs(t *testing.T) {
+	type test struct {
+		input string
+		want  bindTest
+		err   string
+	}
+	tests := []test{
+		{
+			input: "$img[a.png]",
+			want:  bindTest{Src: "a.png", Width: 100, Delay: time.Second},
+		},
+		{
+			input: "$img[a.png width=20 'the alt' ratio=1.5 lazy=yes delay=5ms sizes=1,2,3]",
+			want:  bindTest{Src: "a.png", Alt: "the alt", Width: 20, Ratio: 1.5, Lazy: true, Delay: 5 * time.Millisecond, Sizes: []int{1, 2, 3}},
+		},
+		{input: "$img", err: "bind: argument 0: required"},
+		{input: "$img[a.png width=big]", err: `bind: argument "width": cannot convert "big" to int`},
+		{input: "$img[a.png sizes=1,x]", err: `bind: argument "sizes": cannot convert "x" to int`},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		n := p.Parse(strings.NewReader(tc.input)).FirstChild
+		got := bindTest{}
+		err := BindArgs(n, &got)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("case %d: got error %v want %s", i, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("case %d: got %+v want %+v", i, got, tc.want)
+		}
+	}
+
+	if err := BindArgs(NewElement("x"), bindTest{}); err == nil {
+		t.Errorf("expected error binding to non-pointer")
+	}
+}
+
+func TestBindArgsDefaultCommas(t *testing.T) {
+	type args struct {
+		Sizes []int  `tf:"sizes,required,default=1,2"`
+		Title string `tf:"title,default=a, b"`
+	}
+	got := args{}
+	if err := BindArgs(NewElement("x"), &got); err == nil {
+		t.Errorf("expected error for missing required argument")
+	}
+	type optional struct {
+		Sizes []int  `tf:"sizes,default=1,2"`
+		Title string `tf:"title,default=a, b"`
+	}
+	opt := optional{}
+	if err := BindArgs(NewElement("x"), &opt); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := (optional{Sizes: []int{1, 2}, Title: "a, b"}); !reflect.DeepEqual(opt, want) {
+		t.Errorf("got %+v want %+v", opt, want)
+	}
+}
+
+func TestFunc(t *testing.T) {
+	type repeatArgs struct {
+		Text  string `tf:"0"`
+		Count int    `tf:"count,default=2"`
+	}
+	repeat := Func(func(n *html.Node, args repeatArgs) error {
+		n.Type = html.TextNode
+		n.Attr = nil
+		n.Data = strings.Repeat(args.Text, args.Count)
+		return nil
+	})
+	reg := NewRegistry().Register("repeat", repeat)
+
+	got, err := GenerateHTML("$repeat[ab] $repeat[x count=3]", reg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "abab xxx"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	_, err = GenerateHTML("$repeat[x count=many]", reg)
+	if want := `node repeat: bind: argument "count": cannot convert "many" to int`; err == nil || err.Error() != want {
+		t.Errorf("got error %v want %s", err, want)
+	}
+}
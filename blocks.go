@@ -0,0 +1,153 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Helpers shared by the text based renderers: RenderMarkdown, RenderText
+// and LaTeXRenderer.
+
+// isBlockElement returns true for elements that are rendered as their own block
+func isBlockElement(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.Data {
+	case "root", "p", "h1", "h2", "h3", "h4", "h5", "h6", "pre", "blockquote",
+		"ul", "ol", "li", "table", "hr", "div", "section", "article", "aside",
+		"header", "footer", "nav", "figure", "dl", "details":
+		return true
+	}
+	return false
+}
+
+// topBlock renders n by itself, but not its siblings: as a block, or as
+// a paragraph if it is inline.  It returns nil if there is nothing.
+func topBlock(n *html.Node, block, inline func(*html.Node) string) []string {
+	if isBlockElement(n) {
+		return []string{block(n)}
+	}
+	if text := inline(n); text != "" {
+		return []string{text}
+	}
+	return nil
+}
+
+// writeBlocks writes blocks separated by blank lines, and a final newline
+func writeBlocks(w io.Writer, blocks []string) error {
+	out := strings.Join(blocks, "\n\n")
+	if out != "" {
+		out += "\n"
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// listEntry is an element in a ul or ol, or other content between them
+type listEntry struct {
+	node   *html.Node
+	marker string // "- " or "3. ", empty if node is not an element
+	loose  bool   // has paragraphs, so separate its blocks with a blank line
+}
+
+// listEntries returns the items of a list, numbered from its start
+// attribute if it is an ol.  Text that is only whitespace is skipped.
+func listEntries(n *html.Node, bullet string) []listEntry {
+	num := 1
+	if s, err := strconv.Atoi(GetAttr(n, "start")); err == nil {
+		num = s
+	}
+	var items []listEntry
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			if strings.TrimSpace(TextContent(c)) != "" {
+				items = append(items, listEntry{node: c})
+			}
+			continue
+		}
+		item := listEntry{node: c, marker: bullet}
+		if n.Data == "ol" {
+			item.marker = fmt.Sprintf("%d. ", num)
+			num++
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			if gc.Type == html.ElementNode && (gc.Data == "p" || gc.Data == "pre" || gc.Data == "blockquote") {
+				item.loose = true
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// join combines the blocks of an item, after its marker, with the
+// other lines indented to line up
+func (item listEntry) join(blocks []string) string {
+	sep := "\n"
+	if item.loose {
+		sep = "\n\n"
+	}
+	indent := strings.Repeat(" ", len(item.marker))
+	return item.marker + strings.TrimPrefix(prefixLines(strings.Join(blocks, sep), indent, ""), indent)
+}
+
+// tableRows returns the td and th cells of each row of a table, looking
+// inside thead, tbody and tfoot.  Other elements, such as a caption,
+// are returned as extra.
+func tableRows(n *html.Node) (rows [][]*html.Node, extra []*html.Node) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			case "tr":
+				var row []*html.Node
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						row = append(row, cell)
+					}
+				}
+				rows = append(rows, row)
+			default:
+				extra = append(extra, c)
+			}
+		}
+	}
+	walk(n)
+	return rows, extra
+}
+
+// tableHeader returns true if the first row has a th cell
+func tableHeader(rows [][]*html.Node) bool {
+	if len(rows) == 0 {
+		return false
+	}
+	for _, cell := range rows[0] {
+		if cell.Data == "th" {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixLines adds a prefix to every line, using blank for empty lines
+func prefixLines(s, prefix, blank string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = blank
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
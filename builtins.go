@@ -0,0 +1,39 @@
+package tagfunctions
+
+// Builtins returns a new registry with the built-in functions:
+//
+//	define   macro definitions, see Define
+//	set      set variables, see Set
+//	get      variable value, see Get
+//	var      variable value, see VarFunc
+//	if       conditional content, see If
+//	unless   conditional content, see Unless
+//	switch   conditional content, see Switch
+//	case     used in switch
+//	default  used in switch
+//	each     loops over data, see Each
+//
+// Add other functions to it, or use it as the parent of another registry.
+func Builtins() *Registry {
+	r := NewRegistry()
+	r.RegisterContext("define", Define, WithRawBody(),
+		WithDoc("$define[name params...]{template} creates a macro"))
+	r.RegisterContext("set", Set,
+		WithDoc("$set[name=value ...] or $set[name]{value} sets variables"))
+	r.RegisterContext("get", Get,
+		WithDoc("$get[name default=value] is replaced by a variable"))
+	r.RegisterContext("var", VarFunc,
+		WithDoc("$var{name} is replaced by a variable"))
+	r.RegisterContext("if", If, WithRawBody(),
+		WithDoc("$if[condition]{body $else{body}} includes content if the condition is true"))
+	r.RegisterContext("unless", Unless, WithRawBody(),
+		WithDoc("$unless[condition]{body $else{body}} includes content if the condition is false"))
+	r.RegisterContext("switch", Switch, WithRawBody(),
+		WithDoc("$switch[name]{$case[value ...]{body} $default{body}} includes the matching case"))
+	r.RegisterContext("each", Each, WithRawBody(),
+		WithDoc("$each[item in list]{body} or $each[item src=file]{body} repeats the body for each item"))
+	r.Register("else", outsideIf)
+	r.Register("case", outsideSwitch)
+	r.Register("default", outsideSwitch)
+	return r
+}
@@ -0,0 +1,79 @@
+// Command tagfmt formats tagfunction source.
+//
+// With no files, it formats standard input to standard output.
+//
+//	tagfmt [-l] [-w] [-indent string] [files...]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/client9/tagfunctions"
+)
+
+func main() {
+	list := flag.Bool("l", false, "list files whose formatting differs")
+	write := flag.Bool("w", false, "write result to the source file instead of standard output")
+	indent := flag.String("indent", "\t", "indent for each level of nesting")
+	flag.Parse()
+
+	f := &tagfunctions.Formatter{Indent: *indent}
+	if flag.NArg() == 0 {
+		if *write {
+			fatalf("tagfmt: can not use -w with standard input")
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fatalf("tagfmt: %v", err)
+		}
+		out, err := f.Format(src)
+		if err != nil {
+			fatalf("tagfmt: <stdin>: %v", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	status := 0
+	for _, name := range flag.Args() {
+		if err := formatFile(f, name, *list, *write); err != nil {
+			fmt.Fprintf(os.Stderr, "tagfmt: %v\n", err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func formatFile(f *tagfunctions.Formatter, name string, list, write bool) error {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	out, err := f.Format(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	changed := !bytes.Equal(src, out)
+	if list && changed {
+		fmt.Println(name)
+	}
+	if write {
+		if changed {
+			return os.WriteFile(name, out, 0644)
+		}
+		return nil
+	}
+	if !list {
+		_, err = os.Stdout.Write(out)
+	}
+	return err
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
@@ -0,0 +1,214 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Condition evaluates a condition given as a node's arguments.
+//
+// $if and $unless test variables, see Context.Var.  The condition is the
+// list of arguments, and is true if every test is true:
+//
+//	name          the variable is truthy
+//	!name         the variable is not truthy
+//	name=value    the variable is equal to value
+//	name=a|b|c    the variable is equal to any of the values
+//	name!=value   the variable is not equal to value (or any of a|b|c)
+//
+// A variable is truthy if it is defined and is not empty, "false", "no",
+// "off", "0", nil, false, zero, or an empty slice or map.  Undefined
+// variables compare as the empty string.  Values are compared as text,
+// using FormatValue.
+//
+// An arg with an empty value can not be told apart from a bare name, so
+// name= is the same as name, a truthiness test.  Use !name to test for
+// an empty or undefined variable.
+//
+// For example:
+//
+//	$if[edition=cloud]{...}
+//	$if[edition=cloud|hybrid level!=beginner]{...}
+//	$unless[beta]{...}
+func (ctx *Context) Condition(n *html.Node) (bool, error) {
+	if len(n.Attr) == 0 {
+		return false, fmt.Errorf("missing condition")
+	}
+	for _, attr := range n.Attr {
+		ok, err := ctx.test(attr)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// test evaluates a single part of a condition
+func (ctx *Context) test(attr html.Attribute) (bool, error) {
+	key := attr.Key
+	if attr.Val == "" {
+		if strings.HasPrefix(key, "!") {
+			v, ok := ctx.Var(key[1:])
+			return !(ok && truthy(v)), nil
+		}
+		v, ok := ctx.Var(key)
+		return ok && truthy(v), nil
+	}
+
+	negate := false
+	if strings.HasSuffix(key, "!") {
+		negate = true
+		key = key[:len(key)-1]
+	}
+	if key == "" {
+		return false, fmt.Errorf("missing variable name in %q", attr.Key+"="+attr.Val)
+	}
+	v, _ := ctx.Var(key)
+	actual := FormatValue(v)
+	match := false
+	for _, want := range strings.Split(attr.Val, "|") {
+		if actual == want {
+			match = true
+			break
+		}
+	}
+	return match != negate, nil
+}
+
+// truthy returns false for "empty" values
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case string:
+		switch strings.ToLower(x) {
+		case "", "false", "no", "off", "0":
+			return false
+		}
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Pointer, reflect.Interface:
+		return !rv.IsNil()
+	}
+	return !rv.IsZero()
+}
+
+// If is the $if function.  If the condition is true, see
+// Context.Condition, it is replaced with its body, otherwise with the
+// body of an optional $else child:
+//
+//	$if[edition=cloud]{Sign in to the console. $else{Start the server.}}
+//
+// Only the chosen body is executed.
+func If(ctx *Context, n *html.Node) error {
+	ok, err := ctx.Condition(n)
+	if err != nil {
+		return err
+	}
+	return ctx.choose(n, ok)
+}
+
+// Unless is the $unless function, the opposite of $if
+func Unless(ctx *Context, n *html.Node) error {
+	ok, err := ctx.Condition(n)
+	if err != nil {
+		return err
+	}
+	return ctx.choose(n, !ok)
+}
+
+// choose replaces n with either its body or its $else body
+func (ctx *Context) choose(n *html.Node, ok bool) error {
+	var elseNode *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "else" {
+			elseNode = c
+			break
+		}
+	}
+	body := &html.Node{Type: html.ElementNode, Data: n.Data}
+	switch {
+	case ok:
+		if elseNode != nil {
+			n.RemoveChild(elseNode)
+		}
+		Reparent(body, n)
+	case elseNode != nil:
+		Reparent(body, elseNode)
+	}
+	return ctx.Expand(n, body)
+}
+
+// Switch is the $switch function.  It is replaced by the body of the first
+// $case that lists the value of the variable, or $default if none match:
+//
+//	$switch[edition]{
+//	  $case[cloud]{Sign in to the console.}
+//	  $case[onprem hybrid]{Start the server.}
+//	  $default{Ask your administrator.}
+//	}
+//
+// Anything else inside $switch is ignored.  Undefined variables have the
+// empty value.
+func Switch(ctx *Context, n *html.Node) error {
+	name := GetArg(n, 0)
+	if name == "" || len(n.Attr) != 1 || n.Attr[0].Val != "" {
+		return fmt.Errorf("expected a single variable name")
+	}
+	v, _ := ctx.Var(name)
+	value := FormatValue(v)
+
+	var chosen, fallback *html.Node
+	for c := n.FirstChild; c != nil && chosen == nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "case":
+			if len(c.Attr) == 0 {
+				return fmt.Errorf("$case with no values")
+			}
+			for _, attr := range c.Attr {
+				if attr.Key == value && attr.Val == "" {
+					chosen = c
+				}
+			}
+		case "default":
+			if fallback == nil {
+				fallback = c
+			}
+		}
+	}
+	if chosen == nil {
+		chosen = fallback
+	}
+	body := &html.Node{Type: html.ElementNode, Data: n.Data}
+	if chosen != nil {
+		Reparent(body, chosen)
+	}
+	return ctx.Expand(n, body)
+}
+
+// outsideIf is used for $else, which is only meaningful inside $if
+// or $unless
+func outsideIf(n *html.Node) error {
+	return fmt.Errorf("$%s outside of $if or $unless", n.Data)
+}
+
+// outsideSwitch is used for $case and $default, which are only
+// meaningful inside $switch
+func outsideSwitch(n *html.Node) error {
+	return fmt.Errorf("$%s outside of $switch", n.Data)
+}
@@ -0,0 +1,104 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	vars := map[string]any{
+		"edition": "cloud",
+		"level":   "advanced",
+		"beta":    false,
+		"tags":    []string{"a"},
+		"empty":   []string{},
+		"blank":   "",
+	}
+
+	type test struct {
+		cond string
+		want bool
+	}
+	tests := []test{
+		{"edition=cloud", true},
+		{"edition=onprem", false},
+		{"edition=onprem|cloud", true},
+		{"edition!=cloud", false},
+		{"edition!=onprem|hybrid", true},
+		{"edition=cloud level=advanced", true},
+		{"edition=cloud level=beginner", false},
+		{"level", true},
+		{"!level", false},
+		{"beta", false},
+		{"!beta", true},
+		{"tags", true},
+		{"empty", false},
+		{"missing", false},
+		{"!missing", true},
+		{"missing=", false}, // same as "missing"
+		{"blank=", false},
+		{"!blank", true},
+		{"level=", true},
+		{"missing!=x", true},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		n := p.Parse(strings.NewReader("$if[" + tc.cond + "]{yes $else{no}}"))
+		ex := Executor{Funcs: Builtins(), Vars: vars}
+		if err := ex.Execute(n); err != nil {
+			t.Errorf("case %d: %s: unexpected error %v", i, tc.cond, err)
+			continue
+		}
+		want := "no"
+		if tc.want {
+			want = "yes "
+		}
+		if got := TextContent(n); got != want {
+			t.Errorf("case %d: %s: got %q want %q", i, tc.cond, got, want)
+		}
+	}
+}
+
+func TestConditionalFunctions(t *testing.T) {
+	reg := Builtins().Overlay().Register("b", MakeTag("strong"))
+
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$if[edition=cloud]{$b{cloud}}", "<strong>cloud</strong>"},
+		{"$if[edition=onprem]{$get[undefined]}", ""},
+		{"$unless[edition=onprem]{not onprem}", "not onprem"},
+		{"$unless[edition=cloud]{cloud $else{else}}", "else"},
+		{"$switch[edition]{\n$case[onprem]{A}\n$case[hybrid cloud]{B}\n$default{C}\n}", "B"},
+		{"$switch[level]{$case[onprem]{A}$default{C}}", "C"},
+		{"$switch[level]{$case[onprem]{A}}", ""},
+		// variables set in a chosen branch are visible afterwards
+		{"$if[edition=cloud]{$set[url=https://cloud]}$get[url]", "https://cloud"},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		n := p.Parse(strings.NewReader(tc.input))
+		ex := Executor{Funcs: reg, Vars: map[string]any{"edition": "cloud"}}
+		if err := ex.Execute(n); err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		sb := &strings.Builder{}
+		RenderHTML(sb, n)
+		if want := "<root>" + tc.want + "</root>"; sb.String() != want {
+			t.Errorf("case %d: got %s want %s", i, sb.String(), want)
+		}
+	}
+
+	if _, err := Generate("$case[x]{y}", reg); err == nil || err.Error() != "node case: $case outside of $switch" {
+		t.Errorf("expected error, got %v", err)
+	}
+	if _, err := Generate("$else{y}", reg); err == nil || err.Error() != "node else: $else outside of $if or $unless" {
+		t.Errorf("expected error, got %v", err)
+	}
+	if _, err := Generate("$if{y}", reg); err == nil || err.Error() != "node if: missing condition" {
+		t.Errorf("expected error, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package tagfunctions
+
+import (
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+// ContextFunc is a NodeFunc that also receives the execution context.
+// It is registered with Registry.RegisterContext.
+type ContextFunc func(ctx *Context, n *html.Node) error
+
+// WithRawBody marks a function as handling its own children.
+//
+// Normally children are executed before the function is called.  With
+// a raw body, the function is called first and receives the children
+// as written.  It may discard them, copy them, or execute them with
+// Context.ExecuteChildren.
+func WithRawBody() Option {
+	return func(e *Entry) {
+		e.RawBody = true
+	}
+}
+
+// Context is the state of a running execution
+type Context struct {
+	ex *Executor
+}
+
+// scope holds functions defined while executing the children of owner
+type scope struct {
+	parent *scope
+	owner  *html.Node
+	funcs  map[string]*Entry
+	vars   map[string]any
+}
+
+// Executor returns the executor running this function
+func (ctx *Context) Executor() *Executor {
+	return ctx.ex
+}
+
+// Execute runs the functions on n and its descendants.
+// n is usually a node that is not yet in the tree.
+func (ctx *Context) Execute(n *html.Node) error {
+	return ctx.ex.execute(n)
+}
+
+// ExecuteChildren runs the functions on the children of n
+func (ctx *Context) ExecuteChildren(n *html.Node) error {
+	return ctx.ex.executeChildren(n)
+}
+
+// Expand replaces n with the children of src, and executes them as if
+// they had been in the document all along.  Variables and macros they
+// define are visible to the rest of n's parent.
+func (ctx *Context) Expand(n, src *html.Node) error {
+	if n.Parent == nil {
+		return fmt.Errorf("%s: can not replace the root node", n.Data)
+	}
+	var nodes []*html.Node
+	for c := src.FirstChild; c != nil; c = src.FirstChild {
+		src.RemoveChild(c)
+		n.Parent.InsertBefore(c, n)
+		nodes = append(nodes, c)
+	}
+	n.Parent.RemoveChild(n)
+	for _, c := range nodes {
+		if err := ctx.ex.execute(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register adds a function that is visible from n until the end of
+// n's parent, e.g. a function defined by n for the rest of the document.
+// Local functions take precedence over those in the registry.
+func (ctx *Context) Register(n *html.Node, name string, fn ContextFunc, opts ...Option) {
+	e := &Entry{
+		Name:        name,
+		ContextFunc: fn,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	ctx.localScope(n).funcs[name] = e
+}
+
+// localScope returns the scope for the rest of n's parent, creating it
+// if needed.
+func (ctx *Context) localScope(n *html.Node) *scope {
+	ex := ctx.ex
+	if ex.scope == nil || ex.scope.owner != n.Parent {
+		ex.scope = &scope{
+			parent: ex.scope,
+			owner:  n.Parent,
+			funcs:  make(map[string]*Entry),
+			vars:   make(map[string]any),
+		}
+	}
+	return ex.scope
+}
@@ -6,8 +6,8 @@ import (
 )
 
 func TestTable1(t *testing.T) {
-	fmap := make(map[string]NodeFunc)
-	fmap["csvtable"] = NewCsvTableHTML(nil)
+	fmap := NewRegistry()
+	fmap.Register("csvtable", NewCsvTableHTML(nil))
 
 	doc := `$csvtable{
 A,B,C
@@ -0,0 +1,189 @@
+package tagfunctions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+// Each is the $each function, which repeats its body for every item in
+// a list:
+//
+//	$ul{$each[item in products]{$li{$get[item.name]}}}
+//	$each[row src=prices.csv index=i]{$get[i]: $get[row.price]}
+//
+// The list is a variable (see Context.Var), or a data file read from
+// Executor.FS with src=.  Files ending in .json are decoded with
+// LoadJSON, and .csv with LoadCSV.  Slices and arrays give each element,
+// and maps give a map with "key" and "value" for each entry, sorted by key.
+//
+// For each item, the body is copied and executed with the item bound to
+// the given name, and to the optional index variable counting from 0.
+// Variables set inside the body are only visible in that iteration.
+func Each(ctx *Context, n *html.Node) error {
+	var name, listName, src, index string
+	var positional []string
+	for _, attr := range n.Attr {
+		switch {
+		case attr.Val == "":
+			positional = append(positional, attr.Key)
+		case attr.Key == "src":
+			src = attr.Val
+		case attr.Key == "index":
+			index = attr.Val
+		default:
+			return fmt.Errorf("unknown argument %q", attr.Key)
+		}
+	}
+	switch {
+	case len(positional) == 3 && positional[1] == "in" && src == "":
+		name, listName = positional[0], positional[2]
+	case len(positional) == 1 && src != "":
+		name = positional[0]
+	default:
+		return fmt.Errorf("expected $each[item in list] or $each[item src=file]")
+	}
+
+	var list any
+	if src != "" {
+		var err error
+		if list, err = ctx.loadData(src); err != nil {
+			return err
+		}
+	} else {
+		var ok bool
+		if list, ok = ctx.Var(listName); !ok {
+			if err := ctx.undefined(listName); err != nil {
+				return err
+			}
+		}
+	}
+	items, err := listItems(list)
+	if err != nil {
+		if src != "" {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+		return fmt.Errorf("%s: %v", listName, err)
+	}
+
+	template := &html.Node{Type: html.ElementNode, Data: n.Data}
+	Reparent(template, n)
+
+	out := &html.Node{Type: html.ElementNode, Data: n.Data}
+	ex := ctx.ex
+	for i, item := range items {
+		body := CloneNode(template)
+		ex.scope = &scope{
+			parent: ex.scope,
+			owner:  body,
+			funcs:  make(map[string]*Entry),
+			vars:   map[string]any{name: item},
+		}
+		if index != "" {
+			ex.scope.vars[index] = i
+		}
+		if err := ctx.ExecuteChildren(body); err != nil {
+			return err
+		}
+		Reparent(out, body)
+	}
+
+	// the copies have already been executed
+	if n.Parent == nil {
+		return fmt.Errorf("%s: can not replace the root node", n.Data)
+	}
+	for c := out.FirstChild; c != nil; c = out.FirstChild {
+		out.RemoveChild(c)
+		n.Parent.InsertBefore(c, n)
+	}
+	n.Parent.RemoveChild(n)
+	return nil
+}
+
+// listItems converts a list variable into its items
+func listItems(list any) ([]any, error) {
+	if list == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(list)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		out := make([]any, rv.Len())
+		for i := range out {
+			out[i] = rv.Index(i).Interface()
+		}
+		return out, nil
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = map[string]any{
+				"key":   k.Interface(),
+				"value": rv.MapIndex(k).Interface(),
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expected a list, got %T", list)
+}
+
+// loadData reads a data file from the executor's file system
+func (ctx *Context) loadData(name string) (any, error) {
+	if ctx.ex.FS == nil {
+		return nil, fmt.Errorf("%s: no file system to read from", name)
+	}
+	f, err := ctx.ex.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch path.Ext(name) {
+	case ".json":
+		return LoadJSON(f)
+	case ".csv":
+		return LoadCSV(f)
+	}
+	return nil, fmt.Errorf("%s: unknown data format", name)
+}
+
+// LoadJSON decodes JSON data for use as a variable
+func LoadJSON(r io.Reader) (any, error) {
+	var out any
+	if err := json.NewDecoder(r).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadCSV reads CSV data with a header row for use as a variable.
+// Each row is a map from the column name to the value.
+func LoadCSV(r io.Reader) ([]map[string]string, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := rows[0]
+	out := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		m := make(map[string]string, len(header))
+		for i, col := range header {
+			if i < len(row) {
+				m[col] = row[i]
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEach(t *testing.T) {
+	reg := Builtins()
+	vars := map[string]any{
+		"products": []map[string]string{
+			{"name": "Hammer", "price": "10"},
+			{"name": "Saw", "price": "20"},
+		},
+		"names":  []string{"a", "b", "c"},
+		"counts": map[string]int{"y": 2, "x": 1},
+	}
+	files := fstest.MapFS{
+		"prices.csv": {Data: []byte("name,price\nNail,1\nScrew,2\n")},
+		"tags.json":  {Data: []byte(`[{"tag": "go"}, {"tag": "docs"}]`)},
+	}
+
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$ul{$each[item in products]{$li{$get[item.name]}}}", "<ul><li>Hammer</li><li>Saw</li></ul>"},
+		{"$each[n in names index=i]{$get[i]=$get[n] }", "0=a 1=b 2=c "},
+		{"$each[c in counts]{$get[c.key]:$get[c.value] }", "x:1 y:2 "},
+		{"$each[row src=prices.csv]{$get[row.name]=$get[row.price];}", "Nail=1;Screw=2;"},
+		{"$each[t src=tags.json]{#$get[t.tag] }", "#go #docs "},
+		// loop variables and variables set in the body are local to each iteration
+		{"$each[n in names]{$set[last=$n]}$get[n default=none] $get[last default=none]", "none none"},
+		// nested loops
+		{"$each[a in names]{$each[b in names]{$unless[b=a]{$get[a]$get[b] }}}", "ab ac bb bc cb cc "},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		n := p.Parse(strings.NewReader(tc.input))
+		ex := Executor{Funcs: reg, Vars: vars, FS: files}
+		if err := ex.Execute(n); err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		sb := &strings.Builder{}
+		RenderHTML(sb, n)
+		if want := "<root>" + tc.want + "</root>"; sb.String() != want {
+			t.Errorf("case %d: got %s want %s", i, sb.String(), want)
+		}
+	}
+
+	errs := []string{
+		"$each[item]{x}",
+		"$each[item in missing]{x}",
+		"$each[item in names.0]{x}",
+		"$each[item src=nope.csv]{x}",
+	}
+	for i, src := range errs {
+		p := Tokenizer{}
+		ex := Executor{Funcs: reg, Vars: vars, FS: files}
+		if err := ex.Execute(p.Parse(strings.NewReader(src))); err == nil {
+			t.Errorf("error case %d: expected error for %s", i, src)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Engine is a reusable parse, execute and render pipeline.
+//
+// Configure it once, then process any number of documents.  An Engine
+// is safe for concurrent use, provided the functions, passes and
+// middleware are.
+//
+//	e := Engine{
+//		Executor:  Executor{Funcs: reg, ContinueOnError: true},
+//		Post:      []NodeFunc{(&Paragrapher{Tag: "root"}).Execute},
+//		Positions: true,
+//	}
+//	res, err := e.Process(src)
+type Engine struct {
+	// Executor is the configuration used to execute each document.
+	// Positions and FrontMatter are set for each document.
+	Executor Executor
+
+	// FrontMatter parses an optional front matter header, see ParseFrontMatter.
+	FrontMatter bool
+
+	// Positions tracks source positions, so errors include them.
+	Positions bool
+
+	// Pre are run on the parsed tree before execution,
+	// and Post after execution, before rendering.
+	Pre  []NodeFunc
+	Post []NodeFunc
+
+	// Render writes the output.  If nil, RenderHTMLFragment is used,
+	// which leaves out the root element; use RenderHTML to include it.
+	Render func(io.Writer, *html.Node) error
+
+	// Document renders a complete HTML5 document using the front matter,
+	// see RenderHTMLDocument.  Render is ignored.
+	Document bool
+
+	// Concurrency is the number of documents ProcessAll works on at once.
+	// If zero, runtime.GOMAXPROCS is used.
+	Concurrency int
+}
+
+// Result is the outcome of processing a single document
+type Result struct {
+	Output      string
+	FrontMatter FrontMatter
+
+	// Errors are the failed functions when Executor.ContinueOnError is set.
+	// The output contains error markers in their place.
+	Errors ExecErrors
+
+	// Warnings are problems that did not stop execution
+	Warnings []error
+
+	// Err is set by ProcessAll if the document could not be processed
+	Err error
+}
+
+// Process runs the pipeline on a document.
+//
+// An error is returned if no output could be made, such as for a syntax
+// error.  With Executor.ContinueOnError, function failures are instead
+// reported in Result.Errors.
+func (e *Engine) Process(src string) (*Result, error) {
+	res := &Result{}
+	header := ""
+	if e.FrontMatter {
+		fm, body, err := ParseFrontMatter(src)
+		if err != nil {
+			return nil, err
+		}
+		res.FrontMatter = fm
+		header = src[:len(src)-len(body)]
+		src = body
+	}
+
+	t := Tokenizer{}
+	if e.Positions {
+		t.Positions = make(SourceMap)
+	}
+	n, err := parseSource(&t, src)
+	if err != nil {
+		return nil, err
+	}
+
+	// positions are relative to the original source
+	if header != "" {
+		lines := strings.Count(header, "\n")
+		for node, pos := range t.Positions {
+			pos.Offset += len(header)
+			pos.Line += lines
+			t.Positions[node] = pos
+		}
+	}
+
+	for _, pass := range e.Pre {
+		if err := pass(n); err != nil {
+			return nil, err
+		}
+	}
+
+	ex := e.Executor
+	ex.Positions = t.Positions
+	ex.FrontMatter = res.FrontMatter
+	if err := ex.Execute(n); err != nil {
+		errs, ok := err.(ExecErrors)
+		if !ok {
+			return nil, err
+		}
+		res.Errors = errs
+	}
+	res.Warnings = ex.Warnings()
+
+	for _, pass := range e.Post {
+		if err := pass(n); err != nil {
+			return nil, err
+		}
+	}
+
+	render := e.Render
+	if render == nil {
+		render = RenderHTMLFragment
+	}
+	sb := &strings.Builder{}
+	if e.Document {
+		err = RenderHTMLDocument(sb, n, res.FrontMatter)
+	} else {
+		err = render(sb, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Output = sb.String()
+	return res, nil
+}
+
+// parseSource parses src, returning syntax errors instead of panicking
+func parseSource(t *Tokenizer, src string) (n *html.Node, err error) {
+	defer func() {
+		// parser reports syntax errors with panic
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parse: %v", r)
+		}
+	}()
+	return t.Parse(strings.NewReader(src)), nil
+}
+
+// ProcessAll runs the pipeline on many documents concurrently.
+// The results are in the same order as the sources.
+func (e *Engine) ProcessAll(srcs []string) []*Result {
+	workers := e.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	out := make([]*Result, len(srcs))
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers && i < len(srcs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				res, err := e.Process(srcs[idx])
+				if err != nil {
+					res = &Result{Err: err}
+				}
+				out[idx] = res
+			}
+		}()
+	}
+	for i := range srcs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,84 @@
+package tagfunctions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestEngine(t *testing.T) {
+	reg := Builtins().Overlay().
+		Register("b", MakeTag("strong"), WithConcurrent()).
+		Register("fail", func(n *html.Node) error { return errors.New("oops") })
+
+	e := Engine{
+		Executor: Executor{
+			Funcs:           reg,
+			ContinueOnError: true,
+			Undefined:       UndefinedWarn,
+			ErrorNode: func(n *html.Node, err *ExecError) *html.Node {
+				return NewText("[error]")
+			},
+		},
+		FrontMatter: true,
+		Positions:   true,
+		Post:        []NodeFunc{(&Paragrapher{Tag: "root"}).Execute},
+	}
+
+	src := "---\ntitle: Doc\n---\n$b{$get[title]}\n\n$fail $get[nope]"
+	res, err := e.Process(src)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "<p><strong>Doc</strong></p><p>[error] </p>"; res.Output != want {
+		t.Errorf("got %s want %s", res.Output, want)
+	}
+	if res.FrontMatter.String("title") != "Doc" {
+		t.Errorf("missing front matter: %v", res.FrontMatter)
+	}
+	if len(res.Errors) != 1 || res.Errors[0].Error() != "6:1: node fail: oops" {
+		t.Errorf("unexpected errors %v", res.Errors)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("unexpected warnings %v", res.Warnings)
+	}
+
+	// stop on first error
+	e.Executor.ContinueOnError = false
+	if _, err := e.Process("$fail"); err == nil || err.Error() != "1:1: node fail: oops" {
+		t.Errorf("expected error, got %v", err)
+	}
+}
+
+func TestEngineProcessAll(t *testing.T) {
+	reg := NewRegistry().Register("b", MakeTag("strong"))
+	e := Engine{
+		Executor:    Executor{Funcs: reg},
+		Render:      Render,
+		Concurrency: 4,
+		FrontMatter: true,
+	}
+	var srcs []string
+	for i := 0; i < 20; i++ {
+		srcs = append(srcs, fmt.Sprintf("$b{%d}", i))
+	}
+	srcs = append(srcs, "---\nbroken", "cost ${price}", "$a[href=x")
+
+	results := e.ProcessAll(srcs)
+	for i, res := range results[:20] {
+		if want := fmt.Sprintf("$root{$strong{%d}}", i); res.Err != nil || res.Output != want {
+			t.Errorf("doc %d: got %q %v want %q", i, res.Output, res.Err, want)
+		}
+	}
+	if results[20].Err == nil || !strings.Contains(results[20].Err.Error(), "front matter") {
+		t.Errorf("expected front matter error, got %v", results[20].Err)
+	}
+	for _, res := range results[21:] {
+		if res.Err == nil || !strings.HasPrefix(res.Err.Error(), "parse: ") {
+			t.Errorf("expected parse error, got %v", res.Err)
+		}
+	}
+}
@@ -2,43 +2,29 @@ package tagfunctions
 
 import (
 	"fmt"
-	"strings"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
 
-// Execute parses and renders a tag string
-func Generate(src string, fmap map[string]NodeFunc) (string, error) {
-	if fmap == nil {
-		fmap = make(map[string]NodeFunc)
-	}
-	t := Tokenizer{}
-	n := t.Parse(strings.NewReader(src))
-	if err := Execute(n, fmap); err != nil {
-		return "", err
-	}
-	s := &strings.Builder{}
-	if err := Render(s, n); err != nil {
-		return "", err
-	}
-	return s.String(), nil
+// Generate parses, executes and renders a tag string
+func Generate(src string, reg *Registry) (string, error) {
+	return generate(&Engine{Executor: Executor{Funcs: reg}, Render: Render}, src)
 }
 
-func GenerateHTML(src string, fmap map[string]NodeFunc) (string, error) {
-	if fmap == nil {
-		fmap = make(map[string]NodeFunc)
-	}
-	t := Tokenizer{}
-	n := t.Parse(strings.NewReader(src))
-	if err := Execute(n, fmap); err != nil {
-		return "", err
-	}
-	s := &strings.Builder{}
-	if err := RenderHTML(s, n); err != nil {
+// GenerateHTML parses, executes and renders a tag string as HTML.
+// The output is a fragment, without the <root> element earlier
+// versions included.  See RenderHTML.
+func GenerateHTML(src string, reg *Registry) (string, error) {
+	return generate(&Engine{Executor: Executor{Funcs: reg}, Render: RenderHTMLFragment}, src)
+}
+
+func generate(e *Engine, src string) (string, error) {
+	res, err := e.Process(src)
+	if err != nil {
 		return "", err
 	}
-	return s.String(), nil
+	return res.Output, nil
 }
 
 // Append adds the child to the parent and returns the parent
@@ -89,9 +75,20 @@ func RemoveChildren(n *html.Node) *html.Node {
 }
 
 // Reparent moves children from src to dst, and returns dst
+//
+// It panics if dst and src are the same node, see TryReparent.
 func Reparent(dst, src *html.Node) *html.Node {
+	n, err := TryReparent(dst, src)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// TryReparent is Reparent, returning an error instead of panicking
+func TryReparent(dst, src *html.Node) (*html.Node, error) {
 	if dst == src {
-		panic(fmt.Errorf("Repart: same nodes %s", dst.Data))
+		return nil, fmt.Errorf("Reparent: same nodes %s", dst.Data)
 	}
 	for {
 		child := src.FirstChild
@@ -101,7 +98,7 @@ func Reparent(dst, src *html.Node) *html.Node {
 		src.RemoveChild(child)
 		dst.AppendChild(child)
 	}
-	return dst
+	return dst, nil
 }
 
 func NewElement(name string, kv ...string) *html.Node {
@@ -117,6 +114,25 @@ func NewElement(name string, kv ...string) *html.Node {
 	return n
 }
 
+// CloneNode returns a deep copy of n and its descendants.
+// The copy has no parent or siblings.
+func CloneNode(n *html.Node) *html.Node {
+	out := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+	}
+	if len(n.Attr) > 0 {
+		out.Attr = make([]html.Attribute, len(n.Attr))
+		copy(out.Attr, n.Attr)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		out.AppendChild(CloneNode(c))
+	}
+	return out
+}
+
 func NewText(text string) *html.Node {
 	return &html.Node{
 		Type: html.TextNode,
@@ -179,21 +195,33 @@ func Select(n *html.Node, tag string) string {
 
 // Transform changes ElementNode's name and attributes
 // children remain the same
+//
+// It panics on invalid input, see TryTransformElement.
 func TransformElement(n *html.Node, name string, attr ...string) *html.Node {
+	if _, err := TryTransformElement(n, name, attr...); err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// TryTransformElement is TransformElement, returning an error instead of
+// panicking if n is not an element, the name is empty, or attr does not
+// have key-value pairs.
+func TryTransformElement(n *html.Node, name string, attr ...string) (*html.Node, error) {
 	if n.Type != html.ElementNode {
-		panic("not an element node")
+		return nil, fmt.Errorf("TransformElement: not an element node")
 	}
 	if name == "" {
-		panic("changing an element node to no-name")
+		return nil, fmt.Errorf("TransformElement: changing an element node to no-name")
 	}
 	if len(attr)&1 == 1 {
-		panic("odd number of args given")
+		return nil, fmt.Errorf("TransformElement: odd number of args given")
 	}
 	n.DataAtom = atom.Lookup([]byte(name))
 	n.Data = name
 	n.Attr = nil
 	if len(attr) == 0 {
-		return n
+		return n, nil
 	}
 	n.Attr = make([]html.Attribute, len(attr)/2)
 	j := 0
@@ -201,7 +229,7 @@ func TransformElement(n *html.Node, name string, attr ...string) *html.Node {
 		n.Attr[j] = html.Attribute{Key: attr[i], Val: attr[i+1]}
 		j++
 	}
-	return n
+	return n, nil
 }
 
 func TextContent(n *html.Node) string {
@@ -223,33 +251,13 @@ func TextContent(n *html.Node) string {
 	return out
 }
 
-func ExecuteFunc(m map[string]NodeFunc) NodeFunc {
+func ExecuteFunc(reg *Registry) NodeFunc {
 	return func(n *html.Node) error {
-		return Execute(n, m)
+		return Execute(n, reg)
 	}
 }
 
-func Execute(n *html.Node, fmap map[string]NodeFunc) error {
-	switch n.Type {
-	case html.TextNode:
-		// TODO: Text processing function
-		return nil
-	case html.ElementNode:
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if err := Execute(c, fmap); err != nil {
-				return err
-			}
-		}
-		if fn, ok := fmap[n.Data]; ok {
-			err := fn(n)
-			if err != nil {
-				return fmt.Errorf("Got error in node %s: %v", n.Data, err)
-			}
-			return err
-		}
-		//
-	default:
-		panic("unknown node type")
-	}
-	return nil
+func Execute(n *html.Node, reg *Registry) error {
+	ex := Executor{Funcs: reg}
+	return ex.Execute(n)
 }
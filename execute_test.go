@@ -21,12 +21,10 @@ func TestTransformElement(t *testing.T) {
 }
 
 func TestExecute(t *testing.T) {
-	fmap := map[string]NodeFunc{
-		"link": func(n *html.Node) error {
-			TransformElement(n, "a")
-			return nil
-		},
-	}
+	fmap := NewRegistry().Register("link", func(n *html.Node) error {
+		TransformElement(n, "a")
+		return nil
+	})
 	n := NewElement("link", "href", "https://www.google.com/")
 	sb := &strings.Builder{}
 	if err := Execute(n, fmap); err != nil {
@@ -38,12 +36,10 @@ func TestExecute(t *testing.T) {
 
 func TestExecuteFunc(t *testing.T) {
 
-	fmap := map[string]NodeFunc{
-		"link": func(n *html.Node) error {
-			TransformElement(n, "a")
-			return nil
-		},
-	}
+	fmap := NewRegistry().Register("link", func(n *html.Node) error {
+		TransformElement(n, "a")
+		return nil
+	})
 	exec := ExecuteFunc(fmap)
 
 	n := NewElement("link", "href", "https://www.google.com/")
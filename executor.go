@@ -0,0 +1,360 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"io/fs"
+	"runtime/debug"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Executor runs NodeFuncs over a tree.
+//
+// The zero value behaves like Execute: it stops at the first error.
+// With ContinueOnError set, a failing node is replaced with an error
+// marker and execution continues; all failures are returned together
+// as ExecErrors.
+//
+// An Executor keeps the state of the current run, and the warnings of
+// the last one, so it must not be used by more than one goroutine at a
+// time.  To execute documents concurrently, use an Executor for each;
+// they may share the same Registry.
+type Executor struct {
+	Funcs *Registry
+
+	// ContinueOnError keeps executing after a NodeFunc fails.
+	ContinueOnError bool
+
+	// ErrorNode creates the marker that replaces a failed node when
+	// ContinueOnError is set.  If nil, DefaultErrorNode is used.
+	ErrorNode func(n *html.Node, err *ExecError) *html.Node
+
+	// Positions, if set, is used to report source positions in errors.
+	// Usually this is the Tokenizer's SourceMap.
+	Positions SourceMap
+
+	// Middleware wraps every function call.  The first middleware
+	// is the outermost.
+	Middleware []Middleware
+
+	// Vars are variables available to the document, see Get.
+	Vars map[string]any
+
+	// FrontMatter is the document's metadata, see ParseFrontMatter.
+	// Its values are also available as variables, unless Vars has the
+	// same name.
+	FrontMatter FrontMatter
+
+	// Undefined is what happens when a document uses a variable that
+	// is not defined.  The default is UndefinedError.
+	Undefined UndefinedPolicy
+
+	// FS is used by functions that read files, such as $each[src=...]
+	FS fs.FS
+
+	// MaxDepth limits how deeply macros may expand inside each other,
+	// which stops runaway recursion.  If zero, DefaultMaxDepth is used.
+	MaxDepth int
+
+	// MaxExpansions limits the total number of macro expansions, which
+	// stops macros that grow exponentially.  If zero,
+	// DefaultMaxExpansions is used.
+	//
+	// Going over either limit stops execution, even with
+	// ContinueOnError.
+	MaxExpansions int
+
+	// Workers, if greater than one, runs subtrees that only contain
+	// functions marked WithConcurrent in parallel using this many
+	// goroutines.  They run in batches between the other functions, so
+	// each of those sees the tree as it would in serial execution.
+	Workers int
+
+	// state of the current run, see Execute
+	errs     ExecErrors
+	warnings []error
+	pending  []*job       // concurrent subtrees waiting to run
+	batching bool         // parallel: queue concurrent subtrees
+	text     []*TextEntry // text functions for this execution
+	stack    []string     // names of the ancestors of the current node
+	scope    *scope       // innermost local scope
+	depth    int          // macro expansion depth
+	expanded int          // macro expansions so far
+	strict   bool         // parallel: unknown elements may be functions
+}
+
+// DefaultMaxDepth is the default limit for nested macro expansions
+const DefaultMaxDepth = 32
+
+// DefaultMaxExpansions is the default limit for macro expansions in
+// one execution
+const DefaultMaxExpansions = 10000
+
+// limitError is a runaway execution, which is never continued
+type limitError struct {
+	msg string
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+// ExecError is a failure of a single NodeFunc
+type ExecError struct {
+	Name   string     // function name
+	Node   *html.Node // node being executed
+	Pos    Position   // source position, if HasPos
+	HasPos bool
+	Err    error
+}
+
+func (e *ExecError) Error() string {
+	if e.HasPos {
+		return fmt.Sprintf("%s: node %s: %v", e.Pos, e.Name, e.Err)
+	}
+	return fmt.Sprintf("node %s: %v", e.Name, e.Err)
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// ExecErrors is every failure collected during one execution
+type ExecErrors []*ExecError
+
+func (e ExecErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "%d errors:", len(e))
+	for _, err := range e {
+		sb.WriteString("\n\t")
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+func (e ExecErrors) Unwrap() []error {
+	out := make([]error, len(e))
+	for i, err := range e {
+		out[i] = err
+	}
+	return out
+}
+
+// DefaultErrorNode returns a visible marker for a failed node:
+//
+//	<span class="tf-error">message</span>
+func DefaultErrorNode(n *html.Node, err *ExecError) *html.Node {
+	return Append(NewElement("span", "class", "tf-error"), NewText(err.Error()))
+}
+
+// Execute runs the functions on n and all its descendants.
+func (ex *Executor) Execute(n *html.Node) error {
+	ex.errs = nil
+	ex.warnings = nil
+	ex.pending = nil
+	ex.stack = nil
+	ex.scope = nil
+	ex.depth = 0
+	ex.expanded = 0
+	ex.text = ex.Funcs.TextFuncs()
+	run := ex.execute
+	if ex.Workers > 1 {
+		run = ex.executeParallel
+	}
+	err := run(n)
+	if err != nil {
+		return err
+	}
+	if len(ex.errs) > 0 {
+		errs := ex.errs
+		ex.errs = nil
+		return errs
+	}
+	return nil
+}
+
+func (ex *Executor) execute(n *html.Node) error {
+	switch n.Type {
+	case html.TextNode:
+		return ex.executeText(n)
+	case html.ElementNode:
+		if ex.batching && ex.queueJob(n) {
+			// runs later, with the next batch
+			return nil
+		}
+		e, ok := ex.lookup(n.Data)
+		if ok && e.RawBody {
+			// function runs the children itself, if at all
+			return ex.dispatch(n, e)
+		}
+		if err := ex.executeChildren(n); err != nil {
+			return err
+		}
+		if ok {
+			return ex.dispatch(n, e)
+		}
+	case html.RawNode, html.CommentNode:
+		// output of functions, nothing to do
+	default:
+		panic("unknown node type")
+	}
+	return nil
+}
+
+// executeChildren runs the children of n.  Functions defined by
+// the children with Context.Register are visible until the end of n.
+func (ex *Executor) executeChildren(n *html.Node) error {
+	// functions may remove or replace the child,
+	// so find the next sibling first.
+	ex.stack = append(ex.stack, n.Data)
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		if err := ex.execute(c); err != nil {
+			return err
+		}
+	}
+	ex.stack = ex.stack[:len(ex.stack)-1]
+	for ex.scope != nil && ex.scope.owner == n {
+		ex.scope = ex.scope.parent
+	}
+	return nil
+}
+
+// lookup finds a function, first in the local scopes then the registry
+func (ex *Executor) lookup(name string) (*Entry, bool) {
+	for s := ex.scope; s != nil; s = s.parent {
+		if e, ok := s.funcs[name]; ok {
+			return e, true
+		}
+	}
+	return ex.Funcs.Lookup(name)
+}
+
+// dispatch validates and calls the function for a node
+func (ex *Executor) dispatch(n *html.Node, e *Entry) error {
+	name := n.Data
+	if err := e.Schema.Validate(n); err != nil {
+		return ex.fail(n, name, err)
+	}
+	if ex.batching {
+		// concurrent work before this function in the document
+		// is done first, and any inside it is run serially
+		if err := ex.runBatch(); err != nil {
+			return err
+		}
+		ex.batching = false
+		defer func() { ex.batching = true }()
+	}
+	fn := e.Func
+	if e.ContextFunc != nil {
+		ctx := &Context{ex: ex}
+		fn = func(n *html.Node) error {
+			return e.ContextFunc(ctx, n)
+		}
+	}
+	if err := call(n, ex.wrap(fn)); err != nil {
+		if _, ok := err.(*ExecError); ok {
+			// from a nested execution, already reported
+			return err
+		}
+		return ex.fail(n, name, err)
+	}
+	return nil
+}
+
+// PanicError is a panic inside a function, converted into an error
+type PanicError struct {
+	Name  string     // function name
+	Node  *html.Node // node being executed
+	Value any        // value passed to panic
+	Stack []byte     // stack trace at the time of the panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// call runs fn, converting a panic into a *PanicError
+func call(n *html.Node, fn NodeFunc) (err error) {
+	name := n.Data
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{
+				Name:  name,
+				Node:  n,
+				Value: r,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+	return fn(n)
+}
+
+// Warnings returns the problems that did not stop the last execution,
+// such as undefined variables with UndefinedWarn.
+func (ex *Executor) Warnings() []error {
+	return ex.warnings
+}
+
+// wrap applies the middleware to a function
+func (ex *Executor) wrap(fn NodeFunc) NodeFunc {
+	for i := len(ex.Middleware) - 1; i >= 0; i-- {
+		fn = ex.Middleware[i](fn)
+	}
+	return fn
+}
+
+// executeText runs the text functions on a text node, skipping those
+// excluded by an ancestor.
+func (ex *Executor) executeText(n *html.Node) error {
+	for _, te := range ex.text {
+		if te.skipped(ex.stack) {
+			continue
+		}
+		if err := call(n, NodeFunc(te.Func)); err != nil {
+			return ex.fail(n, te.Name, err)
+		}
+		// replaced or removed: nothing left to transform
+		if n.Parent == nil || n.Type != html.TextNode {
+			return nil
+		}
+	}
+	return nil
+}
+
+// fail records the error.  In stop-on-error mode the error is returned,
+// otherwise the node is replaced by an error marker.
+func (ex *Executor) fail(n *html.Node, name string, err error) error {
+	e := &ExecError{
+		Name: name,
+		Node: n,
+		Err:  err,
+	}
+	if pos, ok := ex.Positions[n]; ok {
+		e.Pos = pos
+		e.HasPos = true
+	}
+	if _, ok := err.(*limitError); ok || !ex.ContinueOnError {
+		return e
+	}
+	ex.errs = append(ex.errs, e)
+
+	marker := ex.ErrorNode
+	if marker == nil {
+		marker = DefaultErrorNode
+	}
+	m := marker(n, e)
+	if n.Parent == nil {
+		// the root node, or detached by the function itself
+		Replace(n, m)
+		return nil
+	}
+	n.Parent.InsertBefore(m, n)
+	n.Parent.RemoveChild(n)
+	return nil
+}
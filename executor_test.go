@@ -0,0 +1,123 @@
+package tagfunctions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func failFunc(n *html.Node) error {
+	return errors.New("broken " + GetArg(n, 0))
+}
+
+func TestExecutorStopOnError(t *testing.T) {
+	fmap := NewRegistry().Register("fail", failFunc)
+	p := Tokenizer{Positions: SourceMap{}}
+	n := p.Parse(strings.NewReader("line1\n  $fail[one] $fail[two]"))
+	ex := Executor{Funcs: fmap, Positions: p.Positions}
+	err := ex.Execute(n)
+	var e *ExecError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected ExecError, got %v", err)
+	}
+	if e.Name != "fail" || !e.HasPos || e.Pos.Line != 2 || e.Pos.Column != 3 {
+		t.Errorf("unexpected error details: %+v", e)
+	}
+	if got, want := err.Error(), "2:3: node fail: broken one"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestExecutorContinueOnError(t *testing.T) {
+	fmap := NewRegistry().
+		Register("fail", failFunc).
+		Register("b", MakeTag("strong"))
+	p := Tokenizer{}
+	n := p.Parse(strings.NewReader("$fail[one] $b{ok} $fail[two]"))
+	ex := Executor{Funcs: fmap, ContinueOnError: true}
+	err := ex.Execute(n)
+
+	var errs ExecErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ExecErrors, got %v", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), err)
+	}
+	sb := &strings.Builder{}
+	if err := RenderHTML(sb, n); err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	want := `<root><span class="tf-error">node fail: broken one</span> <strong>ok</strong> <span class="tf-error">node fail: broken two</span></root>`
+	if got := sb.String(); got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
+
+func TestExecutorPanic(t *testing.T) {
+	reg := NewRegistry().Register("bad", func(n *html.Node) error {
+		SetArg(n, 5, "x")
+		return nil
+	})
+	p := Tokenizer{}
+	n := p.Parse(strings.NewReader("$bad[one]"))
+	err := Execute(n, reg)
+
+	var pe *PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected PanicError, got %v", err)
+	}
+	if pe.Name != "bad" || pe.Node == nil || len(pe.Stack) == 0 {
+		t.Errorf("missing panic details: %+v", pe)
+	}
+	if want := "node bad: panic: SetArg: index 5 out of range for node bad with 1 args"; err.Error() != want {
+		t.Errorf("got %q want %q", err.Error(), want)
+	}
+}
+
+func TestTryHelpers(t *testing.T) {
+	text := NewText("x")
+	if _, err := TryTransformElement(text, "b"); err == nil {
+		t.Errorf("expected error transforming text node")
+	}
+	if _, err := TryTransformElement(NewElement("a"), "b", "odd"); err == nil {
+		t.Errorf("expected error with odd number of attributes")
+	}
+	n := NewElement("a")
+	if _, err := TryReparent(n, n); err == nil {
+		t.Errorf("expected error reparenting to self")
+	}
+	if err := TrySetArg(n, 0, "x"); err == nil {
+		t.Errorf("expected error setting missing arg")
+	}
+}
+
+// each goroutine has its own Executor, sharing one Registry
+func TestExecutorSharedRegistry(t *testing.T) {
+	reg := Builtins()
+	input := "$define[x]{$b{$1}}$set[v=ok]$x[a] $get[v] $if[v=ok]{yes}"
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			p := Tokenizer{}
+			n := p.Parse(strings.NewReader(input))
+			ex := Executor{Funcs: reg}
+			if err := ex.Execute(n); err != nil {
+				errs <- err
+				return
+			}
+			if got, want := TextContent(n), "a ok yes"; got != want {
+				errs <- errors.New("got " + got + " want " + want)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
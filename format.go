@@ -0,0 +1,222 @@
+package tagfunctions
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Formatter rewrites tagfunction source in a canonical form, like gofmt.
+//
+// Args are quoted only when needed.  When an element contains nothing
+// but block elements and whitespace, each block is put on its own line
+// and indented.  All other text is kept exactly as is, since whitespace
+// there may be significant; the contents of pre are never changed.
+// Formatting formatted source gives the same result.
+type Formatter struct {
+	// Indent is used for each level of nesting.  If empty, a tab is used.
+	Indent string
+
+	// IsBlock returns true for elements that may be put on their own
+	// line.  If nil, the standard HTML block elements are used.
+	IsBlock func(*html.Node) bool
+}
+
+// Format formats src with the default Formatter
+func Format(src []byte) ([]byte, error) {
+	return (&Formatter{}).Format(src)
+}
+
+// Format parses src and returns it formatted.  Only the whitespace
+// between blocks and the spelling of function heads change, the content
+// does not; an unmatched "}" is kept as text.
+func (f *Formatter) Format(src []byte) (out []byte, err error) {
+	defer func() {
+		// parser reports syntax errors with panic
+		if r := recover(); r != nil {
+			err = fmt.Errorf("format: %v", r)
+		}
+	}()
+	// with Syntax set, an unmatched "}" is kept as text
+	z := Tokenizer{Syntax: SyntaxMap{}}
+	root := z.Parse(bytes.NewReader(src))
+
+	blocks := f.layout(root, 0)
+	buf := &bytes.Buffer{}
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := formatNode(buf, c); err != nil {
+			return nil, err
+		}
+	}
+	if blocks && buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *Formatter) isBlock(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if f.IsBlock != nil {
+		return f.IsBlock(n)
+	}
+	return isBlockElement(n)
+}
+
+func (f *Formatter) indent(level int) string {
+	if f.Indent == "" {
+		return strings.Repeat("\t", level)
+	}
+	return strings.Repeat(f.Indent, level)
+}
+
+// isSpace returns true for a text node that is only whitespace
+func isSpace(n *html.Node) bool {
+	return n != nil && n.Type == html.TextNode && strings.TrimSpace(n.Data) == ""
+}
+
+// layout rewrites the whitespace between the block children of n, then
+// lays out the children.  It returns true if n only contains blocks.
+func (f *Formatter) layout(n *html.Node, level int) bool {
+	if n.Data == "pre" {
+		return false
+	}
+	blocks := n.Parent == nil || f.isBlock(n)
+	found := false
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case isSpace(c):
+		case f.isBlock(c):
+			found = true
+		default:
+			blocks = false
+		}
+	}
+	blocks = blocks && found
+
+	inner := level
+	if blocks && n.Parent != nil {
+		// the root's children are not indented
+		inner++
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			f.layout(c, inner)
+		}
+	}
+	if !blocks {
+		return false
+	}
+
+	// replace the whitespace before each block
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		if isSpace(c) {
+			continue
+		}
+		sep := "\n"
+		if prev := c.PrevSibling; isSpace(prev) {
+			if strings.Count(prev.Data, "\n") > 1 && prev.PrevSibling != nil {
+				// keep one blank line between blocks
+				sep = "\n\n"
+			}
+			n.RemoveChild(prev)
+		}
+		if c.PrevSibling == nil && n.Parent == nil {
+			// nothing before the first block of the document
+			continue
+		}
+		n.InsertBefore(NewText(sep+f.indent(inner)), c)
+	}
+
+	// and after the last
+	if isSpace(n.LastChild) {
+		n.RemoveChild(n.LastChild)
+	}
+	if n.Parent != nil {
+		n.AppendChild(NewText("\n" + f.indent(level)))
+	}
+	return true
+}
+
+// formatNode is like Render, with canonical quoting of args
+func formatNode(buf *bytes.Buffer, n *html.Node) error {
+	switch n.Type {
+	case html.TextNode:
+		buf.WriteString(n.Data)
+		return nil
+	case html.ElementNode:
+		// below
+	default:
+		return fmt.Errorf("format: unexpected node type %d", n.Type)
+	}
+
+	if body, err := formatHead(buf, n); !body || err != nil {
+		return err
+	}
+	buf.WriteByte('{')
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := formatNode(buf, c); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// formatHead writes "$name" and any args with canonical quoting.
+// It returns false if the element is complete without a body.
+func formatHead(buf *bytes.Buffer, n *html.Node) (bool, error) {
+	buf.WriteByte('$')
+	buf.WriteString(n.Data)
+	if len(n.Attr) == 0 {
+		return true, nil
+	}
+	args := make([]string, len(n.Attr))
+	for i, a := range n.Attr {
+		arg, err := formatArg(a)
+		if err != nil {
+			return false, fmt.Errorf("format: node %s: %w", n.Data, err)
+		}
+		args[i] = arg
+	}
+	buf.WriteString("[" + strings.Join(args, " ") + "]")
+
+	// no children, and "{" would not be read as the start of them
+	next := n.NextSibling
+	return n.FirstChild != nil || (next != nil && next.Type == html.TextNode && strings.HasPrefix(next.Data, "{")), nil
+}
+
+// formatArg writes an arg as key or key=value, quoting the value, or
+// the whole arg if the key needs it.  Double quotes are used unless the
+// text contains them.
+func formatArg(attr html.Attribute) (string, error) {
+	if attr.Val == "" {
+		return quoteArg(attr.Key)
+	}
+	if needsQuote(attr.Key) {
+		return quoteArg(attr.Key + "=" + attr.Val)
+	}
+	val, err := quoteArg(attr.Val)
+	return attr.Key + "=" + val, err
+}
+
+func needsQuote(s string) bool {
+	return s == "" || strings.ContainsAny(s, " \t\r\n\f'\"]")
+}
+
+func quoteArg(s string) (string, error) {
+	switch {
+	case !needsQuote(s):
+		return s, nil
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`, nil
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'", nil
+	}
+	return "", fmt.Errorf("arg %q has both kinds of quote", s)
+}
@@ -0,0 +1,69 @@
+package tagfunctions
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	type test struct {
+		input string
+		want  string
+	}
+
+	tests := []test{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"$b[class='x']{bold}", "$b[class=x]{bold}"},
+		{`$a[href='a b' "k=v w" '"q"']{x}`, `$a[href="a b" k="v w" '"q"']{x}`},
+		{"$img[src=x]", "$img[src=x]"},
+		{"$ul{$li{a}   $li{b $i{x}}}", "$ul{\n\t$li{a}\n\t$li{b $i{x}}\n}\n"},
+		{"\n\n$h1{T}\n\n\n$p{hi  there}$ul{\n$li{$p{a}}}\n",
+			"$h1{T}\n\n$p{hi  there}\n$ul{\n\t$li{\n\t\t$p{a}\n\t}\n}\n"},
+		{"text\n\n$p{x}", "text\n\n$p{x}"},
+		{"$div{$pre{  x\n\n y}}", "$div{\n\t$pre{  x\n\n y}\n}\n"},
+		{"$div{text $p{x}}", "$div{text $p{x}}\n"},
+		{"a}b", "a}b"},
+		{"$b{x}}y", "$b{x}}y"},
+		{"$hr}", "$hr{}}"},
+		{"$p{x}}y", "$p{x}}y"},
+	}
+	for i, tc := range tests {
+		out, err := Format([]byte(tc.input))
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if string(out) != tc.want {
+			t.Errorf("case %d: %q: expected %q, got %q", i, tc.input, tc.want, out)
+		}
+		again, err := Format(out)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if string(again) != string(out) {
+			t.Errorf("case %d: not idempotent: %q then %q", i, out, again)
+		}
+	}
+}
+
+func TestFormatterIndent(t *testing.T) {
+	f := &Formatter{Indent: "  "}
+	out, err := f.Format([]byte("$ul{$li{a}}"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "$ul{\n  $li{a}\n}\n"; string(out) != want {
+		t.Errorf("got %q want %q", out, want)
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	if _, err := Format([]byte("$a[href=x")); err == nil {
+		t.Errorf("expected error for unterminated args")
+	}
+	if _, err := Format([]byte("echo ${HOME}")); err == nil {
+		t.Errorf("expected error for '${'")
+	}
+	if _, err := Format([]byte(`$a['x' "y"]`)); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// FrontMatter is metadata from the header of a document.
+// Values are either a string or a []string.
+type FrontMatter map[string]any
+
+// ParseFrontMatter splits an optional metadata header from a document.
+//
+// The header starts on the first line with "---" or "+++" and ends with
+// the same line.  Between them, each line is "key: value" or
+// "key = value".  Values may be quoted, and lists are written as
+// [a, b, "c d"].  Blank lines and lines starting with # are ignored.
+//
+//	---
+//	title: Installing the Server
+//	date: 2024-05-01
+//	tags: [install, admin]
+//	---
+//	Document starts here.
+//
+// If there is no header, the front matter is nil and the body is src.
+func ParseFrontMatter(src string) (FrontMatter, string, error) {
+	var fence string
+	switch {
+	case strings.HasPrefix(src, "---\n"), strings.HasPrefix(src, "---\r\n"):
+		fence = "---"
+	case strings.HasPrefix(src, "+++\n"), strings.HasPrefix(src, "+++\r\n"):
+		fence = "+++"
+	default:
+		return nil, src, nil
+	}
+
+	fm := make(FrontMatter)
+	rest := src[strings.IndexByte(src, '\n')+1:]
+	lineno := 1
+	for {
+		lineno++
+		if rest == "" {
+			return nil, src, fmt.Errorf("front matter: missing closing %s", fence)
+		}
+		line := rest
+		rest = ""
+		if idx := strings.IndexByte(line, '\n'); idx != -1 {
+			line, rest = line[:idx], line[idx+1:]
+		}
+		line = strings.TrimSpace(line)
+		if line == fence {
+			return fm, rest, nil
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		idx := strings.IndexAny(line, ":=")
+		if idx <= 0 {
+			return nil, src, fmt.Errorf("front matter: line %d: expected key: value, got %q", lineno, line)
+		}
+		key := strings.TrimSpace(line[:idx])
+		fm[key] = parseFrontMatterValue(strings.TrimSpace(line[idx+1:]))
+	}
+}
+
+// parseFrontMatterValue converts a value into a string or list of strings
+func parseFrontMatterValue(val string) any {
+	if len(val) < 2 || val[0] != '[' || val[len(val)-1] != ']' {
+		return unquote(val)
+	}
+	list := []string{}
+	for _, item := range strings.Split(val[1:len(val)-1], ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, unquote(item))
+		}
+	}
+	return list
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// String returns a value as a string, joining lists with ", "
+func (fm FrontMatter) String(key string) string {
+	return FormatValue(fm[key])
+}
+
+// Strings returns a value as a list.  A single string is a list of one.
+func (fm FrontMatter) Strings(key string) []string {
+	switch v := fm[key].(type) {
+	case []string:
+		return v
+	case string:
+		return []string{v}
+	}
+	return nil
+}
+
+// Time parses a value as a date (2006-01-02) or time (RFC 3339)
+func (fm FrontMatter) Time(key string) (time.Time, error) {
+	s := fm.String(key)
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// FrontMatter returns the document's front matter, if any
+func (ctx *Context) FrontMatter() FrontMatter {
+	return ctx.ex.FrontMatter
+}
+
+// GenerateWithFrontMatter is Generate for documents with front matter.
+// The front matter is available to functions as variables, and is returned.
+func GenerateWithFrontMatter(src string, reg *Registry) (string, FrontMatter, error) {
+	return generateWithFrontMatter(src, reg, Render)
+}
+
+// GenerateHTMLWithFrontMatter is GenerateHTML for documents with front matter.
+// The front matter is available to functions as variables, and is returned.
+func GenerateHTMLWithFrontMatter(src string, reg *Registry) (string, FrontMatter, error) {
+	return generateWithFrontMatter(src, reg, RenderHTMLFragment)
+}
+
+func generateWithFrontMatter(src string, reg *Registry, render func(io.Writer, *html.Node) error) (string, FrontMatter, error) {
+	e := Engine{
+		Executor:    Executor{Funcs: reg},
+		FrontMatter: true,
+		Render:      render,
+	}
+	res, err := e.Process(src)
+	if err != nil {
+		return "", nil, err
+	}
+	return res.Output, res.FrontMatter, nil
+}
@@ -0,0 +1,107 @@
+package tagfunctions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	src := `---
+title: "Installing: the Server"
+date: 2024-05-01
+# a comment
+
+tags: [install, "admin guide"]
+draft = no
+---
+Body $b{here}`
+
+	fm, body, err := ParseFrontMatter(src)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := FrontMatter{
+		"title": "Installing: the Server",
+		"date":  "2024-05-01",
+		"tags":  []string{"install", "admin guide"},
+		"draft": "no",
+	}
+	if !reflect.DeepEqual(fm, want) {
+		t.Errorf("got %v want %v", fm, want)
+	}
+	if body != "Body $b{here}" {
+		t.Errorf("got body %q", body)
+	}
+	if got := fm.Strings("tags"); len(got) != 2 {
+		t.Errorf("got tags %v", got)
+	}
+	if got := fm.String("tags"); got != "install, admin guide" {
+		t.Errorf("got tags %q", got)
+	}
+	if d, err := fm.Time("date"); err != nil || d.Month() != 5 {
+		t.Errorf("got date %v %v", d, err)
+	}
+
+	// TOML style
+	fm, body, err = ParseFrontMatter("+++\ntitle = 'x'\n+++\nbody")
+	if err != nil || fm.String("title") != "x" || body != "body" {
+		t.Errorf("got %v %q %v", fm, body, err)
+	}
+
+	// no front matter
+	fm, body, err = ParseFrontMatter("--- not front matter")
+	if err != nil || fm != nil || body != "--- not front matter" {
+		t.Errorf("got %v %q %v", fm, body, err)
+	}
+
+	// errors
+	for _, src := range []string{"---\ntitle: x\n", "---\njunk\n---\n"} {
+		if _, _, err := ParseFrontMatter(src); err == nil {
+			t.Errorf("expected error for %q", src)
+		}
+	}
+}
+
+func TestGenerateWithFrontMatter(t *testing.T) {
+	var seen string
+	reg := Builtins().Overlay().RegisterContext("byline", func(ctx *Context, n *html.Node) error {
+		seen = ctx.FrontMatter().String("author")
+		return nil
+	})
+	src := "---\ntitle: Hello\nauthor: me\n---\n$h1{$get[title]}$byline"
+	out, fm, err := GenerateHTMLWithFrontMatter(src, reg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "<h1>Hello</h1><byline></byline>"; out != want {
+		t.Errorf("got %s want %s", out, want)
+	}
+	if fm.String("title") != "Hello" || seen != "me" {
+		t.Errorf("front matter not available: %v %q", fm, seen)
+	}
+
+	out, _, err = GenerateWithFrontMatter("no front matter", nil)
+	if err != nil || out != "$root{no front matter}" {
+		t.Errorf("got %q %v", out, err)
+	}
+}
+
+// Executor.Vars replace front matter values of the same name
+func TestFrontMatterPrecedence(t *testing.T) {
+	fm, body, err := ParseFrontMatter("---\ntitle: Doc\nauthor: me\n---\n$get[title] by $get[author]")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	p := Tokenizer{}
+	n := p.Parse(strings.NewReader(body))
+	ex := Executor{Funcs: Builtins(), FrontMatter: fm, Vars: map[string]any{"title": "Program"}}
+	if err := ex.Execute(n); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := TextContent(n), "Program by me"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package tagfunctions
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// PositionalPolicy is what HTMLRenderer does with args that have no
+// value, such as the 1 and 2 in $echo[1 2], when they are left on an
+// element.  Args that are boolean HTML attributes, such as disabled,
+// are always kept.
+type PositionalPolicy int
+
+const (
+	// PositionalDrop removes the arg
+	PositionalDrop PositionalPolicy = iota
+
+	// PositionalData converts the arg to data-argN="value", where N is
+	// the index used by GetArg
+	PositionalData
+
+	// PositionalKeep keeps the arg as an attribute with an empty value
+	PositionalKeep
+)
+
+// HTMLRenderer renders an executed tree as HTML, cleaning up args that
+// are not valid HTML attributes.
+//
+// NodeFuncs make attributes with values, so args without a value are
+// usually the arguments of an element no function handled.
+type HTMLRenderer struct {
+	// Positional is what to do with args that have no value
+	Positional PositionalPolicy
+
+	// BooleanAttrs writes boolean attributes without a value,
+	// e.g. <input disabled> instead of <input disabled="">.
+	BooleanAttrs bool
+}
+
+// booleanAttrs are the HTML attributes whose presence means true
+var booleanAttrs = []string{
+	"allowfullscreen", "async", "autofocus", "autoplay", "checked",
+	"controls", "default", "defer", "disabled", "formnovalidate", "hidden",
+	"inert", "ismap", "itemscope", "loop", "multiple", "muted", "nomodule",
+	"novalidate", "open", "playsinline", "readonly", "required", "reversed",
+	"selected",
+}
+
+// Clean fixes the attributes of n and its descendants in place: args
+// without a value are handled by the Positional policy, and attributes
+// whose names are not valid HTML are removed.
+func (hr *HTMLRenderer) Clean(n *html.Node) error {
+	if n.Type == html.ElementNode {
+		hr.cleanAttrs(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		hr.Clean(c)
+	}
+	return nil
+}
+
+func (hr *HTMLRenderer) cleanAttrs(n *html.Node) {
+	if len(n.Attr) == 0 {
+		return
+	}
+	attrs := make([]html.Attribute, 0, len(n.Attr))
+	for i, attr := range n.Attr {
+		if attr.Val == "" && attr.Namespace == "" && !contains(booleanAttrs, strings.ToLower(attr.Key)) {
+			switch hr.Positional {
+			case PositionalDrop:
+				continue
+			case PositionalData:
+				attr = html.Attribute{Key: fmt.Sprintf("data-arg%d", i), Val: attr.Key}
+			}
+		}
+		if !validAttrName(attr.Key) {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+}
+
+// validAttrName checks a name against the HTML syntax for attributes
+func validAttrName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r <= 0x20, r >= 0x7F && r <= 0x9F:
+			// space and controls
+			return false
+		case r == '"', r == '\'', r == '>', r == '/', r == '=':
+			return false
+		case r >= 0xFDD0 && r <= 0xFDEF, r&0xFFFE == 0xFFFE:
+			// noncharacters
+			return false
+		}
+	}
+	return true
+}
+
+// Render writes n as HTML, without changing it
+func (hr *HTMLRenderer) Render(w io.Writer, n *html.Node) error {
+	return hr.render(w, CloneNode(n))
+}
+
+// RenderFragment writes the children of n, but not n itself
+func (hr *HTMLRenderer) RenderFragment(w io.Writer, n *html.Node) error {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := hr.render(w, CloneNode(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// booleanMark replaces the value of boolean attributes while rendering.
+// It can not appear in a rendered value, since html.Render escapes quotes.
+const booleanMark = "\x00tf-boolean\x00"
+
+func (hr *HTMLRenderer) render(w io.Writer, n *html.Node) error {
+	hr.Clean(n)
+	if !hr.BooleanAttrs {
+		return html.Render(w, n)
+	}
+
+	// html.Render always writes a value, so mark the boolean
+	// attributes and remove the values afterwards
+	for _, e := range Selector(n, func(n *html.Node) bool { return n.Type == html.ElementNode }) {
+		for i, attr := range e.Attr {
+			key := strings.ToLower(attr.Key)
+			if contains(booleanAttrs, key) && (attr.Val == "" || strings.EqualFold(attr.Val, key)) {
+				e.Attr[i].Val = booleanMark
+			}
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := html.Render(buf, n); err != nil {
+		return err
+	}
+	_, err := w.Write(bytes.ReplaceAll(buf.Bytes(), []byte(`="`+booleanMark+`"`), nil))
+	return err
+}
@@ -0,0 +1,61 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLRenderer(t *testing.T) {
+	type test struct {
+		hr    HTMLRenderer
+		input string
+		want  string
+	}
+
+	tests := []test{
+		{HTMLRenderer{}, "$echo[1 2]{x}", "<echo>x</echo>"},
+		{HTMLRenderer{Positional: PositionalData}, "$echo[1 2]{x}", `<echo data-arg0="1" data-arg1="2">x</echo>`},
+		{HTMLRenderer{Positional: PositionalKeep}, "$echo[1 2]{x}", `<echo 1="" 2="">x</echo>`},
+		{HTMLRenderer{Positional: PositionalData}, "$p[class=a b]{x}", `<p class="a" data-arg1="b">x</p>`},
+		{HTMLRenderer{}, `$p["a b=c" "x/y=1" ok=1]{x}`, `<p ok="1">x</p>`},
+		{HTMLRenderer{}, "$input[checked]", `<input checked=""/>`},
+		{HTMLRenderer{BooleanAttrs: true}, "$input[checked type=checkbox]", `<input checked type="checkbox"/>`},
+		{HTMLRenderer{BooleanAttrs: true}, "$option[selected=selected]{a}", `<option selected>a</option>`},
+		{HTMLRenderer{BooleanAttrs: true}, "$p[title=checked]{checked=\"\"}", `<p title="checked">checked=&#34;&#34;</p>`},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		node := p.Parse(strings.NewReader(tc.input))
+		before := &strings.Builder{}
+		Render(before, node)
+
+		sb := &strings.Builder{}
+		if err := tc.hr.RenderFragment(sb, node); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if got := sb.String(); got != tc.want {
+			t.Errorf("case %d: %q: expected %s, got %s", i, tc.input, tc.want, got)
+		}
+
+		// the tree is not changed by rendering
+		after := &strings.Builder{}
+		Render(after, node)
+		if before.String() != after.String() {
+			t.Errorf("case %d: tree changed from %s to %s", i, before, after)
+		}
+	}
+}
+
+func TestHTMLRendererClean(t *testing.T) {
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader("$div[1 id=x]{$span[hidden 2]{y}}"))
+	hr := &HTMLRenderer{}
+	if err := hr.Clean(node); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	sb := &strings.Builder{}
+	Render(sb, node)
+	if want := "$root{$div[id=x]{$span[hidden]{y}}}"; sb.String() != want {
+		t.Errorf("expected %s, got %s", want, sb.String())
+	}
+}
@@ -0,0 +1,156 @@
+package tagfunctions
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+// JSONVersion is the version of the JSON tree schema
+const JSONVersion = 1
+
+// JSONTree is the top level of a tree in JSON:
+//
+//	{"version": 1, "root": {...}}
+type JSONTree struct {
+	Version int       `json:"version"`
+	Root    *JSONNode `json:"root"`
+}
+
+// JSONNode is a node in JSON.  Type is one of "element", "text", "raw"
+// or "comment".  Elements have a name, args and children; the others
+// only have text.
+type JSONNode struct {
+	Type     string      `json:"type"`
+	Name     string      `json:"name,omitempty"`
+	Args     []JSONArg   `json:"args,omitempty"`
+	Children []*JSONNode `json:"children,omitempty"`
+	Text     string      `json:"text,omitempty"`
+	Pos      *Position   `json:"pos,omitempty"`
+}
+
+// JSONArg is an arg in JSON.  Positional args have an empty value.
+type JSONArg struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Quoted bool   `json:"quoted"`
+}
+
+var jsonTypes = map[html.NodeType]string{
+	html.ElementNode: "element",
+	html.TextNode:    "text",
+	html.RawNode:     "raw",
+	html.CommentNode: "comment",
+}
+
+// MarshalTree returns the tree n as JSON.  Positions and quotes are
+// included if non-nil, usually from the Tokenizer that parsed n.
+func MarshalTree(n *html.Node, positions SourceMap, quotes QuoteMap) ([]byte, error) {
+	root, err := toJSONNode(n, positions, quotes)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(JSONTree{Version: JSONVersion, Root: root})
+}
+
+func toJSONNode(n *html.Node, positions SourceMap, quotes QuoteMap) (*JSONNode, error) {
+	typ, ok := jsonTypes[n.Type]
+	if !ok {
+		return nil, fmt.Errorf("json: unsupported node type %d", n.Type)
+	}
+	j := &JSONNode{Type: typ}
+	if pos, ok := positions[n]; ok {
+		j.Pos = &pos
+	}
+	if n.Type != html.ElementNode {
+		j.Text = n.Data
+		return j, nil
+	}
+
+	j.Name = n.Data
+	q := quotes[n]
+	for i, a := range n.Attr {
+		arg := JSONArg{Key: a.Key, Value: a.Val}
+		if i < len(q) {
+			arg.Quoted = q[i]
+		}
+		j.Args = append(j.Args, arg)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		child, err := toJSONNode(c, positions, quotes)
+		if err != nil {
+			return nil, err
+		}
+		j.Children = append(j.Children, child)
+	}
+	return j, nil
+}
+
+// UnmarshalTree builds a tree from JSON made by MarshalTree.  If non-nil,
+// positions and quotes are filled in from the JSON.
+func UnmarshalTree(data []byte, positions SourceMap, quotes QuoteMap) (*html.Node, error) {
+	var tree JSONTree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Version != JSONVersion {
+		return nil, fmt.Errorf("json: unsupported version %d", tree.Version)
+	}
+	if tree.Root == nil {
+		return nil, fmt.Errorf("json: missing root")
+	}
+	return fromJSONNode(tree.Root, positions, quotes)
+}
+
+func fromJSONNode(j *JSONNode, positions SourceMap, quotes QuoteMap) (*html.Node, error) {
+	n := &html.Node{}
+	switch j.Type {
+	case "element":
+		if j.Name == "" {
+			return nil, fmt.Errorf("json: element without a name")
+		}
+		n.Type = html.ElementNode
+		n.Data = j.Name
+	case "text":
+		n.Type = html.TextNode
+	case "raw":
+		n.Type = html.RawNode
+	case "comment":
+		n.Type = html.CommentNode
+	default:
+		return nil, fmt.Errorf("json: unknown node type %q", j.Type)
+	}
+	if j.Pos != nil && positions != nil {
+		positions[n] = *j.Pos
+	}
+	if n.Type != html.ElementNode {
+		if len(j.Args) > 0 || len(j.Children) > 0 {
+			return nil, fmt.Errorf("json: %s node with args or children", j.Type)
+		}
+		n.Data = j.Text
+		return n, nil
+	}
+
+	if len(j.Args) > 0 {
+		q := make([]bool, len(j.Args))
+		for i, a := range j.Args {
+			n.Attr = append(n.Attr, html.Attribute{Key: a.Key, Val: a.Value})
+			q[i] = a.Quoted
+		}
+		if quotes != nil {
+			quotes[n] = q
+		}
+	}
+	for _, jc := range j.Children {
+		if jc == nil {
+			return nil, fmt.Errorf("json: null child in %s", j.Name)
+		}
+		c, err := fromJSONNode(jc, positions, quotes)
+		if err != nil {
+			return nil, err
+		}
+		n.AppendChild(c)
+	}
+	return n, nil
+}
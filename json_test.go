@@ -0,0 +1,119 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"plain text",
+		"$b{bold $i{italic}} text",
+		`$a[href="x y" "two words" plain]{link}`,
+		"$echo[1 2 3]",
+		"$ul{\n\t$li{a}\n\t$li{b}\n}\n",
+	}
+	for i, src := range tests {
+		z := Tokenizer{Positions: SourceMap{}, Quotes: QuoteMap{}}
+		node := z.Parse(strings.NewReader(src))
+		data, err := MarshalTree(node, z.Positions, z.Quotes)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+
+		positions, quotes := SourceMap{}, QuoteMap{}
+		back, err := UnmarshalTree(data, positions, quotes)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		sb := strings.Builder{}
+		Render(&sb, back)
+		if want := "$root{" + src + "}"; sb.String() != want {
+			t.Errorf("case %d: expected %q, got %q", i, want, sb.String())
+		}
+
+		// and back to the same JSON
+		again, err := MarshalTree(back, positions, quotes)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if string(again) != string(data) {
+			t.Errorf("case %d: expected %s, got %s", i, data, again)
+		}
+	}
+}
+
+func TestMarshalTree(t *testing.T) {
+	z := Tokenizer{Positions: SourceMap{}, Quotes: QuoteMap{}}
+	node := z.Parse(strings.NewReader(`$b[class="x" y]{hi}`))
+	data, err := MarshalTree(node.FirstChild, z.Positions, z.Quotes)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := `{"version":1,"root":{"type":"element","name":"b",` +
+		`"args":[{"key":"class","value":"x","quoted":true},{"key":"y","value":"","quoted":false}],` +
+		`"children":[{"type":"text","text":"hi","pos":{"offset":16,"line":1,"column":17}}],` +
+		`"pos":{"offset":0,"line":1,"column":1}}}`
+	if string(data) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, data)
+	}
+
+	// without positions or quotes
+	data, err = MarshalTree(node.FirstChild, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want = `{"version":1,"root":{"type":"element","name":"b",` +
+		`"args":[{"key":"class","value":"x","quoted":false},{"key":"y","value":"","quoted":false}],` +
+		`"children":[{"type":"text","text":"hi"}]}}`
+	if string(data) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, data)
+	}
+}
+
+func TestMarshalTreeExecuted(t *testing.T) {
+	node := NewElement("root")
+	Append(node, NewText("a "), NewElement("b"))
+	node.LastChild.Type = html.ErrorNode
+	if _, err := MarshalTree(node, nil, nil); err == nil {
+		t.Errorf("expected error for error node")
+	}
+
+	// raw nodes, such as from $entity, are kept
+	z := Tokenizer{}
+	node = z.Parse(strings.NewReader("$entity[amp]"))
+	if err := Execute(node, NewRegistry().Register("entity", Entity)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	data, err := MarshalTree(node, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	back, err := UnmarshalTree(data, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if c := back.FirstChild; c == nil || c.Type != node.FirstChild.Type || c.Data != "&amp;" {
+		t.Errorf("raw node not kept: %s", data)
+	}
+}
+
+func TestUnmarshalTreeErrors(t *testing.T) {
+	tests := []string{
+		`not json`,
+		`{"version":2,"root":{"type":"element","name":"root"}}`,
+		`{"version":1}`,
+		`{"version":1,"root":{"type":"element"}}`,
+		`{"version":1,"root":{"type":"bogus"}}`,
+		`{"version":1,"root":{"type":"text","children":[{"type":"text"}]}}`,
+		`{"version":1,"root":{"type":"element","name":"root","children":[null]}}`,
+	}
+	for i, data := range tests {
+		if _, err := UnmarshalTree([]byte(data), nil, nil); err == nil {
+			t.Errorf("case %d: expected error for %s", i, data)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package tagfunctions
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// LaTeXFunc converts an element to LaTeX.  Content is the element's
+// children, already converted.
+type LaTeXFunc func(n *html.Node, content string) (string, error)
+
+// LaTeXRenderer renders an executed tree as LaTeX
+type LaTeXRenderer struct {
+	// Elements maps element names to custom conversions.  These are
+	// used before the built in ones, so may also replace them.
+	Elements map[string]LaTeXFunc
+}
+
+// RenderLaTeX renders an executed tree as the body of a LaTeX document,
+// using only the built in conversions.  See LaTeXRenderer.Render.
+func RenderLaTeX(w io.Writer, n *html.Node) error {
+	return (&LaTeXRenderer{}).Render(w, n)
+}
+
+// Render writes n as LaTeX.
+//
+// Headings become sections, with b, i, code and others mapped to the
+// usual commands.  Lists use itemize and enumerate, pre uses verbatim,
+// tables use tabular and links use \href from the hyperref package.
+// Text is escaped.  Unknown elements are replaced by their children,
+// and empty lists and tables are left out.  The root element is not
+// rendered.
+func (lr *LaTeXRenderer) Render(w io.Writer, n *html.Node) error {
+	lw := &latexWriter{elements: lr.Elements}
+	blocks := topBlock(n, lw.block, func(n *html.Node) string {
+		return strings.TrimSpace(lw.inline(n))
+	})
+	if lw.err != nil {
+		return lw.err
+	}
+	return writeBlocks(w, blocks)
+}
+
+type latexWriter struct {
+	elements map[string]LaTeXFunc
+	err      error // first error from a custom conversion
+	cell     bool  // inside a table cell
+}
+
+// custom runs a custom conversion, if any
+func (lw *latexWriter) custom(n *html.Node, content func() string) (string, bool) {
+	fn, ok := lw.elements[n.Data]
+	if !ok {
+		return "", false
+	}
+	out, err := fn(n, content())
+	if err != nil && lw.err == nil {
+		lw.err = err
+	}
+	return out, true
+}
+
+// blocks converts the children of n into paragraphs and environments
+func (lw *latexWriter) blocks(n *html.Node) []string {
+	var blocks []string
+	sb := strings.Builder{}
+	flush := func() {
+		if text := strings.TrimSpace(sb.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		sb.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBlockElement(c) {
+			sb.WriteString(lw.inline(c))
+			continue
+		}
+		flush()
+		if b := lw.block(c); b != "" {
+			blocks = append(blocks, b)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func (lw *latexWriter) block(n *html.Node) string {
+	if out, ok := lw.custom(n, func() string { return strings.Join(lw.blocks(n), "\n\n") }); ok {
+		return out
+	}
+	switch n.Data {
+	case "p":
+		return strings.TrimSpace(lw.children(n))
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return latexSections[n.Data] + "{" + strings.TrimSpace(lw.children(n)) + "}"
+	case "hr":
+		return `\noindent\rule{\linewidth}{0.4pt}`
+	case "pre":
+		return latexPre(strings.TrimSuffix(TextContent(n), "\n"))
+	case "blockquote":
+		return latexEnv("quote", strings.Join(lw.blocks(n), "\n\n"))
+	case "ul", "ol":
+		return lw.list(n)
+	case "li":
+		return `\item ` + strings.Join(lw.blocks(n), "\n\n")
+	case "table":
+		return lw.table(n)
+	}
+	// div, section and other containers
+	return strings.Join(lw.blocks(n), "\n\n")
+}
+
+var latexSections = map[string]string{
+	"h1": `\section`,
+	"h2": `\subsection`,
+	"h3": `\subsubsection`,
+	"h4": `\paragraph`,
+	"h5": `\subparagraph`,
+	"h6": `\subparagraph`,
+}
+
+// latexPre uses verbatim, unless the text would end it early.  Then
+// the lines are escaped and set in a typewriter font instead.
+func latexPre(text string) string {
+	if !strings.Contains(text, `\end{verbatim}`) {
+		return latexEnv("verbatim", text)
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		// "~" keeps spaces and empty lines
+		lines[i] = strings.ReplaceAll(EscapeLaTeX(line), " ", "~")
+		if lines[i] == "" {
+			lines[i] = "~"
+		}
+	}
+	return latexEnv("flushleft", "\\ttfamily\n"+strings.Join(lines, "\\\\\n"))
+}
+
+func latexEnv(name, body string) string {
+	return `\begin{` + name + "}\n" + body + "\n\\end{" + name + "}"
+}
+
+func (lw *latexWriter) list(n *html.Node) string {
+	env := "itemize"
+	if n.Data == "ol" {
+		env = "enumerate"
+	}
+	var items []string
+	for _, item := range listEntries(n, "") {
+		if item.node.Type == html.ElementNode && item.node.Data == "li" {
+			items = append(items, lw.block(item.node))
+			continue
+		}
+		if text := strings.TrimSpace(lw.inline(item.node)); text != "" {
+			items = append(items, `\item `+text)
+		}
+	}
+	if len(items) == 0 {
+		// an environment with no \item does not compile
+		return ""
+	}
+	return latexEnv(env, strings.Join(items, "\n"))
+}
+
+// table uses a tabular with left aligned columns.  A header row is
+// followed by a rule.
+func (lw *latexWriter) table(n *html.Node) string {
+	cells, _ := tableRows(n)
+	cols := 0
+	for _, row := range cells {
+		cols = max(cols, len(row))
+	}
+	if cols == 0 {
+		// nor does an empty column spec
+		return ""
+	}
+	lines := make([]string, 0, len(cells)+1)
+	for i, row := range cells {
+		texts := make([]string, cols)
+		for j, cell := range row {
+			lw.cell = true
+			texts[j] = strings.TrimSpace(lw.children(cell))
+			lw.cell = false
+		}
+		lines = append(lines, strings.Join(texts, " & ")+` \\`)
+		if i == 0 && tableHeader(cells) {
+			lines = append(lines, `\hline`)
+		}
+	}
+	return "\\begin{tabular}{" + strings.Repeat("l", cols) + "}\n" +
+		strings.Join(lines, "\n") + "\n\\end{tabular}"
+}
+
+func (lw *latexWriter) children(n *html.Node) string {
+	sb := strings.Builder{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(lw.inline(c))
+	}
+	return sb.String()
+}
+
+var latexCommands = map[string]string{
+	"b":      `\textbf`,
+	"strong": `\textbf`,
+	"i":      `\emph`,
+	"em":     `\emph`,
+	"cite":   `\emph`,
+	"code":   `\texttt`,
+	"tt":     `\texttt`,
+	"kbd":    `\texttt`,
+	"var":    `\textit`,
+	"u":      `\underline`,
+	"sup":    `\textsuperscript`,
+	"sub":    `\textsubscript`,
+}
+
+func (lw *latexWriter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return EscapeLaTeX(whitespaceRegexp.ReplaceAllString(n.Data, " "))
+	case html.RawNode:
+		// entities from $entity
+		return EscapeLaTeX(html.UnescapeString(n.Data))
+	case html.ElementNode:
+		// below
+	default:
+		return ""
+	}
+	if out, ok := lw.custom(n, func() string { return lw.children(n) }); ok {
+		return out
+	}
+	if cmd, ok := latexCommands[n.Data]; ok {
+		return cmd + "{" + lw.children(n) + "}"
+	}
+	switch n.Data {
+	case "br":
+		if lw.cell {
+			// "\\" would end the row
+			return " "
+		}
+		return "\\\\\n"
+	case "a":
+		href := GetAttr(n, "href")
+		text := lw.children(n)
+		if href == "" {
+			return text
+		}
+		if strings.TrimSpace(TextContent(n)) == href {
+			return `\url{` + escapeLaTeXURL(href) + "}"
+		}
+		return `\href{` + escapeLaTeXURL(href) + "}{" + text + "}"
+	case "img":
+		return `\includegraphics{` + escapeLaTeXURL(GetAttr(n, "src")) + "}"
+	}
+	return lw.children(n)
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"$", `\$`,
+	"&", `\&`,
+	"#", `\#`,
+	"_", `\_`,
+	"%", `\%`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+// EscapeLaTeX escapes the characters special to LaTeX in plain text
+func EscapeLaTeX(s string) string {
+	return latexEscaper.Replace(s)
+}
+
+var latexURLEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"#", `\#`,
+	"%", `\%`,
+	"{", `\{`,
+	"}", `\}`,
+)
+
+// escapeLaTeXURL escapes the characters hyperref can not take as is.
+// It is also used for file names.
+func escapeLaTeXURL(s string) string {
+	return latexURLEscaper.Replace(s)
+}
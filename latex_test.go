@@ -0,0 +1,124 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderLaTeX(t *testing.T) {
+	type test struct {
+		input string
+		want  string
+	}
+
+	tests := []test{
+		{"", ""},
+		{"$p{one}$p{two}", "one\n\ntwo\n"},
+		{"$h1{Intro}$h3{Detail}", "\\section{Intro}\n\n\\subsubsection{Detail}\n"},
+		{"$p{$b{bold} $i{it} $code{x}}", "\\textbf{bold} \\emph{it} \\texttt{x}\n"},
+		{"$p{50% of $5 & a_b #1 ~ ^ \\}", "50\\% of \\$5 \\& a\\_b \\#1 \\textasciitilde{} \\textasciicircum{} \\textbackslash{}\n"},
+		{"$p{a $entity[amp] b}", "a \\& b\n"},
+		{"$pre{x_1 = 50%\n}", "\\begin{verbatim}\nx_1 = 50%\n\\end{verbatim}\n"},
+		{"$ul{$li{one} $li{two}}", "\\begin{itemize}\n\\item one\n\\item two\n\\end{itemize}\n"},
+		{"$ol{$li{one}}", "\\begin{enumerate}\n\\item one\n\\end{enumerate}\n"},
+		{"$blockquote{quoted}", "\\begin{quote}\nquoted\n\\end{quote}\n"},
+		{`$p{$a[href="http://a.com/#x"]{a_link}}`, "\\href{http://a.com/\\#x}{a\\_link}\n"},
+		{`$p{$a[href="http://a.com"]{http://a.com}}`, "\\url{http://a.com}\n"},
+		{"$table{$tr{$th{a}$th{b}}$tr{$td{1}$td{2}}}", "\\begin{tabular}{ll}\na & b \\\\\n\\hline\n1 & 2 \\\\\n\\end{tabular}\n"},
+		{"$p{$span{plain}}", "plain\n"},
+		{"$p{$img[src=a%b#c.png]}", "\\includegraphics{a\\%b\\#c.png}\n"},
+		{"$table{$tr{$td{a$br{}b}$td{c}}}", "\\begin{tabular}{ll}\na b & c \\\\\n\\end{tabular}\n"},
+		{"$ul{}", ""},
+		{"$ol{ }$p{x}", "x\n"},
+		{"$table{}", ""},
+		{"$table{$tr{}}", ""},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		node := p.Parse(strings.NewReader(tc.input))
+		reg := NewRegistry().Register("entity", Entity)
+		if err := Execute(node, reg); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		sb := strings.Builder{}
+		if err := RenderLaTeX(&sb, node); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if got := sb.String(); got != tc.want {
+			t.Errorf("case %d: %q: expected %q, got %q", i, tc.input, tc.want, got)
+		}
+	}
+}
+
+// verbatim can not contain its own end
+func TestRenderLaTeXPreEnd(t *testing.T) {
+	pre := Append(NewElement("pre"), NewText("a\\end{verbatim}  b\n\nc"))
+	sb := strings.Builder{}
+	if err := RenderLaTeX(&sb, pre); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := "\\begin{flushleft}\n\\ttfamily\na\\textbackslash{}end\\{verbatim\\}~~b\\\\\n~\\\\\nc\n\\end{flushleft}\n"
+	if sb.String() != want {
+		t.Errorf("expected %q, got %q", want, sb.String())
+	}
+}
+
+func TestEscapeLaTeX(t *testing.T) {
+	got := EscapeLaTeX(`{a}\b`)
+	if want := `\{a\}\textbackslash{}b`; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestRenderLaTeXSiblings(t *testing.T) {
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader("$b{one} $p{two} three"))
+	for i, tc := range []struct {
+		n    *html.Node
+		want string
+	}{
+		{node.FirstChild, "\\textbf{one}\n"},
+		{node.FirstChild.NextSibling.NextSibling, "two\n"},
+	} {
+		sb := strings.Builder{}
+		if err := RenderLaTeX(&sb, tc.n); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if sb.String() != tc.want {
+			t.Errorf("case %d: expected %q, got %q", i, tc.want, sb.String())
+		}
+	}
+}
+
+func TestLaTeXRendererElements(t *testing.T) {
+	lr := &LaTeXRenderer{
+		Elements: map[string]LaTeXFunc{
+			"note": func(n *html.Node, content string) (string, error) {
+				return `\footnote{` + content + "}", nil
+			},
+			"b": func(n *html.Node, content string) (string, error) {
+				return `{\bfseries ` + content + "}", nil
+			},
+			"bad": func(n *html.Node, content string) (string, error) {
+				return "", fmt.Errorf("bad element")
+			},
+		},
+	}
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader("$p{text$note{a $b{b}}}"))
+	sb := strings.Builder{}
+	if err := lr.Render(&sb, node); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "text\\footnote{a {\\bfseries b}}\n"; sb.String() != want {
+		t.Errorf("got %q want %q", sb.String(), want)
+	}
+
+	node = p.Parse(strings.NewReader("$bad{x}"))
+	if err := lr.Render(&strings.Builder{}, node); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -0,0 +1,236 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/net/html"
+)
+
+// Define is the $define function, which creates a macro from a template:
+//
+//	$define[warn]{$div[class=warning]{$strong{Warning:} $body}}
+//	$warn{Do not feed the gophers.}
+//
+// The first argument is the macro name.  Any other arguments declare
+// parameters, either positional (a name) or named with a default
+// (name=value).  Inside the template:
+//
+//   - $body is replaced by the children of the call
+//   - $1, $2, ... are replaced by the call's positional arguments
+//   - $name is replaced by the value of a declared parameter
+//
+// Substitution happens in text, and in argument keys and values:
+//
+//	$define[note title=Note]{$div[class=$title]{$b{$title} $body}}
+//	$note[title=Tip]{Use a registry.}
+//
+// A call binds its positional arguments to the declared parameters in
+// order, and named arguments by name.  Unknown named arguments are an
+// error.
+//
+// The macro is visible from the definition to the end of the enclosing
+// element, and takes precedence over registered functions.  The expanded
+// template is executed, so macros may use other macros and functions.
+// Macros and variables defined by the template are local to the
+// expansion.  Recursion is limited by Executor.MaxDepth, and the total
+// number of expansions by Executor.MaxExpansions.
+//
+// Define must be registered with WithRawBody, see Builtins.
+func Define(ctx *Context, n *html.Node) error {
+	if len(n.Attr) == 0 || n.Attr[0].Val != "" {
+		return fmt.Errorf("missing macro name")
+	}
+	m := &macro{
+		name: n.Attr[0].Key,
+		body: &html.Node{Type: html.ElementNode, Data: "define"},
+	}
+	for _, attr := range n.Attr[1:] {
+		m.params = append(m.params, macroParam{
+			name:       attr.Key,
+			value:      attr.Val,
+			hasDefault: attr.Val != "",
+		})
+	}
+
+	Reparent(m.body, n)
+	ctx.Register(n, m.name, m.expand, WithRawBody())
+	if n.Parent != nil {
+		n.Parent.RemoveChild(n)
+	}
+	return nil
+}
+
+type macroParam struct {
+	name       string
+	value      string
+	hasDefault bool
+}
+
+type macro struct {
+	name   string
+	params []macroParam
+	body   *html.Node // template is the children
+}
+
+var (
+	macroPositional = regexp.MustCompile(`\$[0-9]+`)
+	macroNamed      = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_-]*`)
+)
+
+// expand replaces the call n with the executed template
+func (m *macro) expand(ctx *Context, n *html.Node) error {
+	ex := ctx.ex
+	limit := ex.MaxDepth
+	if limit == 0 {
+		limit = DefaultMaxDepth
+	}
+	if ex.depth >= limit {
+		return &limitError{fmt.Sprintf("macro %s: more than %d nested expansions, recursive macro?", m.name, limit)}
+	}
+	total := ex.MaxExpansions
+	if total == 0 {
+		total = DefaultMaxExpansions
+	}
+	if ex.expanded >= total {
+		return &limitError{fmt.Sprintf("macro %s: more than %d expansions", m.name, total)}
+	}
+	ex.expanded++
+
+	// bind arguments
+	var positional []string
+	values := make(map[string]string)
+	for _, p := range m.params {
+		if p.hasDefault {
+			values[p.name] = p.value
+		}
+	}
+	for _, attr := range n.Attr {
+		if attr.Val == "" {
+			if len(positional) < len(m.params) {
+				values[m.params[len(positional)].name] = attr.Key
+			}
+			positional = append(positional, attr.Key)
+			continue
+		}
+		if !m.hasParam(attr.Key) {
+			return fmt.Errorf("macro %s: unknown parameter %q", m.name, attr.Key)
+		}
+		values[attr.Key] = attr.Val
+	}
+
+	out := CloneNode(m.body)
+	s := substitution{
+		macro:      m,
+		values:     values,
+		positional: positional,
+		body:       n,
+	}
+	s.apply(out)
+
+	if n.Parent == nil {
+		return fmt.Errorf("%s: can not replace the root node", n.Data)
+	}
+	ex.depth++
+	defer func() { ex.depth-- }()
+
+	// run the template on its own, so the macros and variables it
+	// defines end with the expansion
+	if err := ex.executeChildren(out); err != nil {
+		return err
+	}
+	for c := out.FirstChild; c != nil; c = out.FirstChild {
+		out.RemoveChild(c)
+		n.Parent.InsertBefore(c, n)
+	}
+	n.Parent.RemoveChild(n)
+	return nil
+}
+
+func (m *macro) hasParam(name string) bool {
+	for _, p := range m.params {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// substitution is a single expansion of a macro template
+type substitution struct {
+	macro      *macro
+	values     map[string]string
+	positional []string
+	body       *html.Node // the call, whose children replace $body
+	bodyUsed   bool
+}
+
+func (s *substitution) apply(n *html.Node) {
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+			c.Data = s.replace(c.Data)
+		case html.ElementNode:
+			if r := s.replacement(c); r != nil {
+				for r.FirstChild != nil {
+					child := r.FirstChild
+					r.RemoveChild(child)
+					n.InsertBefore(child, c)
+				}
+				n.RemoveChild(c)
+				continue
+			}
+			for i := range c.Attr {
+				c.Attr[i].Key = s.replace(c.Attr[i].Key)
+				c.Attr[i].Val = s.replace(c.Attr[i].Val)
+			}
+			s.apply(c)
+		}
+	}
+}
+
+// replacement returns a holder with the nodes that replace a $body or
+// $param element, or nil if the element is not replaced.
+func (s *substitution) replacement(n *html.Node) *html.Node {
+	holder := &html.Node{Type: html.ElementNode, Data: "body"}
+	if n.Data == "body" {
+		if !s.bodyUsed {
+			s.bodyUsed = true
+			Reparent(holder, s.body)
+			// keep a copy for any other $body
+			for c := holder.FirstChild; c != nil; c = c.NextSibling {
+				s.body.AppendChild(CloneNode(c))
+			}
+			return holder
+		}
+		for c := s.body.FirstChild; c != nil; c = c.NextSibling {
+			holder.AppendChild(CloneNode(c))
+		}
+		return holder
+	}
+	if s.macro.hasParam(n.Data) {
+		holder.AppendChild(NewText(s.values[n.Data]))
+		return holder
+	}
+	return nil
+}
+
+// replace substitutes $1... and $param in a string
+func (s *substitution) replace(text string) string {
+	text = macroPositional.ReplaceAllStringFunc(text, func(arg string) string {
+		i, _ := strconv.Atoi(arg[1:])
+		if i < 1 || i > len(s.positional) {
+			return arg
+		}
+		return s.positional[i-1]
+	})
+	return macroNamed.ReplaceAllStringFunc(text, func(arg string) string {
+		if !s.macro.hasParam(arg[1:]) {
+			return arg
+		}
+		return s.values[arg[1:]]
+	})
+}
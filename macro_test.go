@@ -0,0 +1,120 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefine(t *testing.T) {
+	reg := Builtins().Overlay().Register("b", MakeTag("strong"))
+
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{
+			"$define[warn]{$div[class=warning]{$strong{Warning:} $body}}$warn{Do not $b{feed}.}",
+			`<div class="warning"><strong>Warning:</strong> Do not <strong>feed</strong>.</div>`,
+		},
+		{
+			`$define[link]{$a[href=$1]{$2}}$link[http://x.org "the site"]`,
+			`<a href="http://x.org">the site</a>`,
+		},
+		{
+			"$define[note title=Note]{$div[class=$title]{$b{$title} $body}}$note{a} $note[title=Tip]{b}",
+			`<div class="Note"><strong>Note</strong> a</div> <div class="Tip"><strong>Tip</strong> b</div>`,
+		},
+		{
+			// positional arguments bind to declared parameters
+			"$define[pair left right]{$left and $right}$pair[a b]",
+			`a and b`,
+		},
+		{
+			// body may be used more than once
+			"$define[twice]{$body or $body}$twice{$b{x}}",
+			`<strong>x</strong> or <strong>x</strong>`,
+		},
+		{
+			// macros may use macros
+			"$define[x]{X}$define[y]{$x$x}$y",
+			`XX`,
+		},
+		{
+			// macros are visible until the end of the enclosing element
+			"$div{$define[x]{X}$x} $x",
+			`<div>X</div> <x></x>`,
+		},
+		{
+			// macros defined by a template are local to the expansion
+			"$define[outer]{$define[inner]{I}$inner}$outer $inner",
+			`I <inner></inner>`,
+		},
+		{
+			// macros take precedence over functions
+			"$define[b]{B}$b{bold}",
+			`B`,
+		},
+	}
+	for i, tc := range tests {
+		got, err := GenerateHTML(tc.input, reg)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("case %d: got %s want %s", i, got, tc.want)
+		}
+	}
+}
+
+func TestDefineErrors(t *testing.T) {
+	reg := Builtins()
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$define{x}", "node define: missing macro name"},
+		{"$define[x]{X}$x[color=red]", `node x: macro x: unknown parameter "color"`},
+		{"$define[loop]{$loop}$loop", "node loop: macro loop: more than 32 nested expansions, recursive macro?"},
+	}
+	for i, tc := range tests {
+		_, err := GenerateHTML(tc.input, reg)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: got %v want %s", i, err, tc.want)
+		}
+	}
+
+	p := Tokenizer{}
+	n := p.Parse(strings.NewReader("$define[loop]{$loop}$loop"))
+	ex := Executor{Funcs: reg, MaxDepth: 3}
+	if err := ex.Execute(n); err == nil || !strings.Contains(err.Error(), "more than 3") {
+		t.Errorf("expected depth error, got %v", err)
+	}
+}
+
+// runaway macros stop execution, even when continuing on errors
+func TestDefineLimitsContinueOnError(t *testing.T) {
+	reg := Builtins()
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$define[a]{$a$a}$a", "more than 32 nested expansions"},
+		{
+			"$define[a]{x}$define[b]{$a$a$a$a}$define[c]{$b$b$b$b}$define[d]{$c$c$c$c}" +
+				"$define[e]{$d$d$d$d}$define[f]{$e$e$e$e}$define[g]{$f$f$f$f}$define[h]{$g$g$g$g}$h",
+			"more than 10000 expansions",
+		},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		n := p.Parse(strings.NewReader(tc.input))
+		ex := Executor{Funcs: reg, ContinueOnError: true}
+		if err := ex.Execute(n); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("case %d: got %v want %s", i, err, tc.want)
+		}
+	}
+}
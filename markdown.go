@@ -0,0 +1,282 @@
+package tagfunctions
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RenderMarkdown renders an executed tree as CommonMark, with GitHub
+// extensions for tables and strikethrough.
+//
+// Common HTML elements are converted: p, h1-h6, b/strong, i/em, code,
+// pre, a, img, ul/ol/li, blockquote, table, hr, br and del/s.  Anything
+// else, or that can not be expressed, such as a table cell containing
+// a list, is written as inline HTML.  The root element is not rendered.
+func RenderMarkdown(w io.Writer, n *html.Node) error {
+	return writeBlocks(w, topBlock(n, markdownBlock, func(n *html.Node) string {
+		return escapeBlockStart(strings.TrimSpace(markdownInline(n)))
+	}))
+}
+
+// markdownBlocks converts the children of n into blocks.  Runs of inline
+// nodes are combined into a paragraph.
+func markdownBlocks(n *html.Node) []string {
+	var blocks []string
+	var inline []*html.Node
+	flush := func() {
+		if len(inline) == 0 {
+			return
+		}
+		text := strings.TrimSpace(markdownInlines(inline))
+		if text != "" {
+			blocks = append(blocks, escapeBlockStart(text))
+		}
+		inline = nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBlockElement(c) {
+			inline = append(inline, c)
+			continue
+		}
+		flush()
+		if b := markdownBlock(c); b != "" {
+			blocks = append(blocks, b)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func markdownBlock(n *html.Node) string {
+	switch n.Data {
+	case "root":
+		return strings.Join(markdownBlocks(n), "\n\n")
+	case "p":
+		return escapeBlockStart(strings.TrimSpace(markdownChildren(n)))
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.Data[1] - '0')
+		text := strings.TrimSpace(markdownChildren(n))
+		return strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " ")
+	case "hr":
+		return "---"
+	case "pre":
+		return markdownPre(n)
+	case "blockquote":
+		return prefixLines(strings.Join(markdownBlocks(n), "\n\n"), "> ", ">")
+	case "ul", "ol":
+		if out, ok := markdownList(n); ok {
+			return out
+		}
+	case "table":
+		if out, ok := markdownTable(n); ok {
+			return out
+		}
+	}
+	return renderHTMLString(n)
+}
+
+// markdownPre converts a pre block into a fenced code block, with the
+// language from a "language-xxx" class on the pre or an inner code.
+func markdownPre(n *html.Node) string {
+	lang := languageClass(n)
+	if c := n.FirstChild; c != nil && c == n.LastChild && c.Type == html.ElementNode && c.Data == "code" && lang == "" {
+		lang = languageClass(c)
+	}
+	text := strings.TrimSuffix(TextContent(n), "\n")
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + text + "\n" + fence
+}
+
+func languageClass(n *html.Node) string {
+	for _, cz := range strings.Fields(GetAttr(n, "class")) {
+		if strings.HasPrefix(cz, "language-") {
+			return cz[len("language-"):]
+		}
+	}
+	return ""
+}
+
+// markdownList converts a list.  It fails if there is content outside of
+// the list items.
+func markdownList(n *html.Node) (string, bool) {
+	var items []string
+	for _, item := range listEntries(n, "- ") {
+		if item.node.Type != html.ElementNode || item.node.Data != "li" {
+			return "", false
+		}
+		items = append(items, item.join(markdownBlocks(item.node)))
+	}
+	return strings.Join(items, "\n"), true
+}
+
+// markdownTable converts a table to a GitHub table.  It fails if a cell
+// contains block content, or there is a caption.
+func markdownTable(n *html.Node) (string, bool) {
+	cells, extra := tableRows(n)
+	if len(extra) > 0 || len(cells) == 0 {
+		return "", false
+	}
+	rows := make([][]string, len(cells))
+	for i, row := range cells {
+		for _, cell := range row {
+			for gc := cell.FirstChild; gc != nil; gc = gc.NextSibling {
+				if isBlockElement(gc) {
+					return "", false
+				}
+			}
+			text := strings.TrimSpace(markdownChildren(cell))
+			text = strings.ReplaceAll(text, "|", `\|`)
+			text = strings.ReplaceAll(text, "\n", " ")
+			rows[i] = append(rows[i], text)
+		}
+	}
+
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	line := func(row []string) string {
+		for len(row) < cols {
+			row = append(row, "")
+		}
+		return "| " + strings.Join(row, " | ") + " |"
+	}
+	lines := []string{line(rows[0])}
+	sep := make([]string, cols)
+	for i := range sep {
+		sep[i] = "---"
+	}
+	lines = append(lines, line(sep))
+	for _, row := range rows[1:] {
+		lines = append(lines, line(row))
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+func markdownChildren(n *html.Node) string {
+	var nodes []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+	return markdownInlines(nodes)
+}
+
+func markdownInlines(nodes []*html.Node) string {
+	sb := strings.Builder{}
+	for _, n := range nodes {
+		sb.WriteString(markdownInline(n))
+	}
+	return sb.String()
+}
+
+var whitespaceRegexp = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+func markdownInline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return escapeMarkdown(whitespaceRegexp.ReplaceAllString(n.Data, " "))
+	case html.RawNode:
+		return n.Data
+	case html.ElementNode:
+		// below
+	default:
+		return ""
+	}
+
+	switch n.Data {
+	case "b", "strong":
+		return wrapInline(markdownChildren(n), "**")
+	case "i", "em":
+		return wrapInline(markdownChildren(n), "*")
+	case "del", "s":
+		return wrapInline(markdownChildren(n), "~~")
+	case "code":
+		return markdownCode(TextContent(n))
+	case "br":
+		return "\\\n"
+	case "a":
+		href := GetAttr(n, "href")
+		return "[" + markdownChildren(n) + "](" + markdownURL(href) + markdownTitle(n) + ")"
+	case "img":
+		alt := escapeMarkdown(GetAttr(n, "alt"))
+		return "![" + alt + "](" + markdownURL(GetAttr(n, "src")) + markdownTitle(n) + ")"
+	}
+	return renderHTMLString(n)
+}
+
+// wrapInline adds emphasis markers, keeping surrounding spaces outside
+func wrapInline(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := text[:strings.Index(text, trimmed)]
+	end := text[len(start)+len(trimmed):]
+	return start + marker + trimmed + marker + end
+}
+
+// markdownCode uses enough backticks to contain the text
+func markdownCode(text string) string {
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+func markdownURL(u string) string {
+	if strings.ContainsAny(u, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(u) + ">"
+	}
+	return u
+}
+
+func markdownTitle(n *html.Node) string {
+	title := GetAttr(n, "title")
+	if title == "" {
+		return ""
+	}
+	return ` "` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+}
+
+var (
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`,
+		"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`,
+	)
+	entityLike     = regexp.MustCompile(`&(#?[a-zA-Z0-9]+;)`)
+	orderedLike    = regexp.MustCompile(`^(\d+)([.)])`)
+	blockStartLike = regexp.MustCompile(`^([#+=-]|~~~)`)
+)
+
+func escapeMarkdown(s string) string {
+	s = markdownEscaper.Replace(s)
+	return entityLike.ReplaceAllString(s, `\&$1`)
+}
+
+// escapeBlockStart escapes text at the start of a paragraph that would
+// otherwise be a heading or list
+func escapeBlockStart(s string) string {
+	if m := orderedLike.FindStringSubmatchIndex(s); m != nil {
+		return s[:m[4]] + `\` + s[m[4]:]
+	}
+	if blockStartLike.MatchString(s) {
+		return `\` + s
+	}
+	return s
+}
+
+func renderHTMLString(n *html.Node) string {
+	sb := strings.Builder{}
+	html.Render(&sb, n)
+	return sb.String()
+}
@@ -0,0 +1,95 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	type test struct {
+		input string
+		want  string
+	}
+
+	tests := []test{
+		{"", ""},
+		{"$p{hello world}", "hello world\n"},
+		{"$p{one}$p{two}", "one\n\ntwo\n"},
+		{"$h2{Title}$p{text}", "## Title\n\ntext\n"},
+		{"$p{$b{bold} and $i{italic} and $em{ em }}", "**bold** and *italic* and  *em*\n"},
+		{"$p{$code{x := `y`}}", "`` x := `y` ``\n"},
+		{"$p{a*b_c [d]}", "a\\*b\\_c \\[d\\]\n"},
+		{"$p{# not a heading}", "\\# not a heading\n"},
+		{"$p{1. not a list}", "1\\. not a list\n"},
+		{"$p{&copy;}", "\\&copy;\n"},
+		{`$p{$a[href="http://x.com" title=home]{link}}`, "[link](http://x.com \"home\")\n"},
+		{`$p{$img[src="a b.png" alt=pic]}`, "![pic](<a b.png>)\n"},
+		{"$p{line$br{}next}", "line\\\nnext\n"},
+		{"$p{$del{gone}}", "~~gone~~\n"},
+		{"$hr{}", "---\n"},
+		{"$pre[class=language-go]{x := 1\n}", "```go\nx := 1\n```\n"},
+		{"$pre{$code[class=language-sh]{ls}}", "```sh\nls\n```\n"},
+		{"$blockquote{$p{one}$p{two}}", "> one\n>\n> two\n"},
+		{"$ul{$li{one} $li{two}}", "- one\n- two\n"},
+		{"$ol[start=3]{$li{one}$li{two}}", "3. one\n4. two\n"},
+		{"$ul{$li{one $ul{$li{nested}}}}", "- one\n  - nested\n"},
+		{"$ol{$li{$p{a}$p{b}}}", "1. a\n\n   b\n"},
+		{"$table{$tr{$th{a}$th{b}}$tr{$td{1}$td{x|y}}}", "| a | b |\n| --- | --- |\n| 1 | x\\|y |\n"},
+		{"$table{$tr{$td{$ul{$li{x}}}}}", "<table><tr><td><ul><li>x</li></ul></td></tr></table>\n"},
+		{"$p{$span[class=x]{hi}}", "<span class=\"x\">hi</span>\n"},
+		{"$div{text}", "<div>text</div>\n"},
+		{"loose $b{text}", "loose **text**\n"},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		node := p.Parse(strings.NewReader(tc.input))
+		sb := strings.Builder{}
+		if err := RenderMarkdown(&sb, node); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if got := sb.String(); got != tc.want {
+			t.Errorf("case %d: %q: expected %q, got %q", i, tc.input, tc.want, got)
+		}
+	}
+}
+
+func TestRenderMarkdownCsvTable(t *testing.T) {
+	src := "$csvtable{a,b\n1,2\n}"
+	reg := NewRegistry()
+	reg.Register("csvtable", NewCsvTableHTML(nil))
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader(src))
+	if err := Execute(node, reg); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	sb := strings.Builder{}
+	if err := RenderMarkdown(&sb, node); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := "| a | b |\n| --- | --- |\n| 1 | 2 |\n"
+	if sb.String() != want {
+		t.Errorf("got %q want %q", sb.String(), want)
+	}
+}
+
+func TestRenderMarkdownSiblings(t *testing.T) {
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader("$b{one} $p{two} three"))
+	for i, tc := range []struct {
+		n    *html.Node
+		want string
+	}{
+		{node.FirstChild, "**one**\n"},
+		{node.FirstChild.NextSibling.NextSibling, "two\n"},
+	} {
+		sb := strings.Builder{}
+		if err := RenderMarkdown(&sb, tc.n); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if sb.String() != tc.want {
+			t.Errorf("case %d: expected %q, got %q", i, tc.want, sb.String())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Middleware wraps a NodeFunc, e.g. for logging or metrics.
+//
+// When called, n.Data is still the name of the function being run.
+type Middleware func(next NodeFunc) NodeFunc
+
+// FuncStats are the metrics for a single function
+type FuncStats struct {
+	Name   string
+	Calls  int
+	Errors int
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// Metrics collects per-function timing.  It is safe for concurrent use.
+type Metrics struct {
+	mu    sync.Mutex
+	stats map[string]*FuncStats
+}
+
+// Middleware returns a middleware that records into m.  A panic is
+// only counted as an error if Recover is after it.
+func (m *Metrics) Middleware() Middleware {
+	return func(next NodeFunc) NodeFunc {
+		return func(n *html.Node) error {
+			name := n.Data
+			start := time.Now()
+			err := next(n)
+			m.add(name, time.Since(start), err != nil)
+			return err
+		}
+	}
+}
+
+func (m *Metrics) add(name string, d time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats == nil {
+		m.stats = make(map[string]*FuncStats)
+	}
+	s, ok := m.stats[name]
+	if !ok {
+		s = &FuncStats{Name: name}
+		m.stats[name] = s
+	}
+	s.Calls++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+	if failed {
+		s.Errors++
+	}
+}
+
+// Stats returns the metrics sorted by total time, slowest first
+func (m *Metrics) Stats() []FuncStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]FuncStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// WriteTo writes a table of the metrics, slowest first
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "%-20s %8s %8s %12s %12s\n", "function", "calls", "errors", "total", "max")
+	for _, s := range m.Stats() {
+		fmt.Fprintf(&sb, "%-20s %8d %8d %12s %12s\n", s.Name, s.Calls, s.Errors, s.Total, s.Max)
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// Recover returns a middleware that converts a panic into a *PanicError.
+//
+// The Executor already does this for every function, so this is only
+// needed to recover before an outer middleware sees the panic.  Put it
+// after, that is inside, the middleware that should see the panic as an
+// error, such as Metrics:
+//
+//	Middleware: []Middleware{metrics.Middleware(), Recover()}
+func Recover() Middleware {
+	return func(next NodeFunc) NodeFunc {
+		return func(n *html.Node) error {
+			return call(n, next)
+		}
+	}
+}
+
+// Trace returns a middleware that logs each function's input and output,
+// rendered with Render:
+//
+//	b: $b{bold} => $strong{bold}
+func Trace(w io.Writer) Middleware {
+	mu := sync.Mutex{}
+	return func(next NodeFunc) NodeFunc {
+		return func(n *html.Node) error {
+			name := n.Data
+			in := renderTrace(n)
+
+			// the function may replace n, so remember where it was
+			parent, prev, after := n.Parent, n.PrevSibling, n.NextSibling
+
+			err := next(n)
+
+			var out string
+			if parent == nil {
+				out = renderTrace(n)
+			} else {
+				start := parent.FirstChild
+				if prev != nil {
+					start = prev.NextSibling
+				}
+				for c := start; c != nil && c != after; c = c.NextSibling {
+					out += renderTrace(c)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Fprintf(w, "%s: %s => %s (error: %v)\n", name, in, out, err)
+			} else {
+				fmt.Fprintf(w, "%s: %s => %s\n", name, in, out)
+			}
+			return err
+		}
+	}
+}
+
+// renderTrace renders a node with Render, falling back to HTML for
+// nodes such as raw HTML that have no source form.
+func renderTrace(n *html.Node) string {
+	sb := strings.Builder{}
+	if err := Render(&sb, n); err == nil {
+		return sb.String()
+	}
+	sb.Reset()
+	if err := RenderHTML(&sb, n); err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return sb.String()
+}
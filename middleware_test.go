@@ -0,0 +1,69 @@
+package tagfunctions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestMiddleware(t *testing.T) {
+	reg := NewRegistry().
+		Register("b", MakeTag("strong")).
+		Register("csvtable", NewCsvTableHTML(nil)).
+		Register("ent", Entity).
+		Register("oops", func(n *html.Node) error {
+			var list []int
+			list[3] = 1
+			return nil
+		})
+
+	trace := &strings.Builder{}
+	metrics := &Metrics{}
+	ex := Executor{
+		Funcs:           reg,
+		ContinueOnError: true,
+		Middleware:      []Middleware{metrics.Middleware(), Recover(), Trace(trace)},
+	}
+
+	p := Tokenizer{}
+	n := p.Parse(strings.NewReader("$b{bold} $csvtable{a\n1} $ent[copy] $oops $b{x}"))
+	err := ex.Execute(n)
+	var errs ExecErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !strings.Contains(errs[0].Error(), "panic: runtime error: index out of range") {
+		t.Fatalf("expected recovered panic, got %v", err)
+	}
+
+	want := []string{
+		"b: $b{bold} => $strong{bold}",
+		"csvtable: $csvtable{a\n1} => $table{$thead{$tr{$th{a}}}$tbody{$tr{$td{1}}}}",
+		"ent: $ent[copy] => &copy;",
+		"b: $b{x} => $strong{x}",
+	}
+	got := trace.String()
+	for _, line := range want {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("trace missing %q, got:\n%s", line, got)
+		}
+	}
+
+	stats := metrics.Stats()
+	calls := map[string]int{}
+	failed := map[string]int{}
+	for _, s := range stats {
+		calls[s.Name] = s.Calls
+		failed[s.Name] = s.Errors
+	}
+	if calls["b"] != 2 || calls["csvtable"] != 1 || calls["ent"] != 1 || calls["oops"] != 1 {
+		t.Errorf("unexpected metrics %+v", stats)
+	}
+	if failed["oops"] != 1 || failed["b"] != 0 {
+		t.Errorf("expected the panic to be counted as an error, got %+v", stats)
+	}
+	report := &strings.Builder{}
+	metrics.WriteTo(report)
+	if !strings.HasPrefix(report.String(), "function") {
+		t.Errorf("unexpected report %s", report.String())
+	}
+}
@@ -0,0 +1,168 @@
+package tagfunctions
+
+import (
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// WithConcurrent marks a function as safe to run concurrently with other
+// concurrent functions.
+//
+// A concurrent function may only change its own node, its descendants
+// and its position in its parent (e.g. replacing itself).  It must not
+// look at or change siblings or other ancestors, and must not depend on
+// shared mutable state.
+func WithConcurrent() Option {
+	return func(e *Entry) {
+		e.Concurrent = true
+	}
+}
+
+// job is a subtree executed by a worker
+type job struct {
+	node        *html.Node
+	stack       []string   // names of the original ancestors
+	scope       *scope     // local scope where the job was queued
+	holder      *html.Node // temporary parent while running
+	placeholder *html.Node // marks the original location in the tree
+	err         error
+	errs        ExecErrors
+	warnings    []error
+}
+
+// executeParallel walks the tree like serial execution, but queues each
+// subtree that only contains concurrent functions.  The queued subtrees
+// are run by a pool of workers just before the next function that is not
+// concurrent, and at the end.  Since concurrent functions only change
+// their own subtree, every function sees the same tree as it would in
+// serial execution.
+func (ex *Executor) executeParallel(n *html.Node) error {
+	// functions with raw bodies, such as $define, may create new
+	// functions, so then any unknown element may be a function.
+	ex.strict = ex.hasRawBody(n)
+	ex.batching = true
+	defer func() {
+		ex.batching = false
+		ex.pending = nil
+	}()
+	if err := ex.execute(n); err != nil {
+		return err
+	}
+	return ex.runBatch()
+}
+
+// queueJob queues n as a job if it is the top of a subtree where every
+// function is concurrent
+func (ex *Executor) queueJob(n *html.Node) bool {
+	if n.Parent == nil || !ex.concurrentTree(n) {
+		return false
+	}
+	if _, ok := ex.lookup(n.Data); !ok {
+		return false
+	}
+	stack := make([]string, len(ex.stack))
+	copy(stack, ex.stack)
+	ex.pending = append(ex.pending, &job{node: n, stack: stack, scope: ex.scope})
+	return true
+}
+
+// runBatch runs the queued jobs using a pool of workers.
+//
+// Each subtree is detached into a temporary parent so that functions
+// replacing their own node do not modify shared nodes.  Once all the
+// workers are done, the results are put back in their original place.
+func (ex *Executor) runBatch() error {
+	jobs := ex.pending
+	ex.pending = nil
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	// detach
+	for _, j := range jobs {
+		j.holder = &html.Node{Type: html.ElementNode, Data: "root"}
+		j.placeholder = &html.Node{Type: html.ElementNode, Data: "placeholder"}
+		j.node.Parent.InsertBefore(j.placeholder, j.node)
+		j.node.Parent.RemoveChild(j.node)
+		j.holder.AppendChild(j.node)
+	}
+
+	// run
+	queue := make(chan *job)
+	wg := sync.WaitGroup{}
+	for i := 0; i < ex.Workers && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				sub := *ex
+				sub.errs = nil
+				sub.warnings = nil
+				sub.pending = nil
+				sub.batching = false
+				sub.stack = j.stack
+				sub.scope = j.scope
+				j.err = sub.execute(j.node)
+				j.errs = sub.errs
+				j.warnings = sub.warnings
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	// reattach, in document order
+	var firstErr error
+	for _, j := range jobs {
+		parent := j.placeholder.Parent
+		for c := j.holder.FirstChild; c != nil; c = j.holder.FirstChild {
+			j.holder.RemoveChild(c)
+			parent.InsertBefore(c, j.placeholder)
+		}
+		parent.RemoveChild(j.placeholder)
+		if j.err != nil && firstErr == nil {
+			firstErr = j.err
+		}
+		ex.errs = append(ex.errs, j.errs...)
+		ex.warnings = append(ex.warnings, j.warnings...)
+	}
+	return firstErr
+}
+
+// concurrentTree returns true if every function in the subtree is
+// concurrent.  Local functions, such as macros, shadow the registry.
+func (ex *Executor) concurrentTree(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return true
+	}
+	e, ok := ex.lookup(n.Data)
+	if ok && !e.Concurrent || !ok && ex.strict {
+		return false
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !ex.concurrentTree(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRawBody returns true if any function in the tree has a raw body
+func (ex *Executor) hasRawBody(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if e, ok := ex.lookup(n.Data); ok && e.RawBody {
+		return true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if ex.hasRawBody(c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package tagfunctions
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+func TestExecuteParallel(t *testing.T) {
+	var running, most int32
+	slow := func(n *html.Node) error {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if now <= m || atomic.CompareAndSwapInt32(&most, m, now) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		TransformElement(n, "code")
+		return nil
+	}
+
+	// "section" is not concurrent, and so runs after its children
+	order := []string{}
+	section := func(n *html.Node) error {
+		order = append(order, TextContent(n))
+		TransformElement(n, "section")
+		return nil
+	}
+
+	reg := NewRegistry().
+		Register("slow", slow, WithConcurrent()).
+		Register("b", MakeTag("strong"), WithConcurrent()).
+		Register("csvtable", NewCsvTableHTML(nil), WithConcurrent()).
+		Register("sec", section)
+
+	src := "$sec{$slow{1} $slow{2}} $b{$slow{3}} $csvtable{a,b\n1,2} $slow{4} $sec{$slow{5}}"
+
+	serial := Tokenizer{}
+	want := serial.Parse(strings.NewReader(src))
+	if err := Execute(want, reg); err != nil {
+		t.Fatalf("serial execution failed: %v", err)
+	}
+
+	order = nil
+	p := Tokenizer{}
+	got := p.Parse(strings.NewReader(src))
+	ex := Executor{Funcs: reg, Workers: 4}
+	if err := ex.Execute(got); err != nil {
+		t.Fatalf("parallel execution failed: %v", err)
+	}
+
+	sb1, sb2 := &strings.Builder{}, &strings.Builder{}
+	RenderHTML(sb1, want)
+	RenderHTML(sb2, got)
+	if sb1.String() != sb2.String() {
+		t.Errorf("parallel output differs:\n got %s\nwant %s", sb2.String(), sb1.String())
+	}
+	if most < 2 {
+		t.Errorf("expected functions to run concurrently, max was %d", most)
+	}
+	if len(order) != 2 || order[0] != "1 2" || order[1] != "5" {
+		t.Errorf("unexpected serial order %q", order)
+	}
+}
+
+func TestExecuteParallelMacros(t *testing.T) {
+	reg := Builtins().Overlay().Register("b", MakeTag("strong"), WithConcurrent())
+	src := "$define[x]{$b{X}}$div{$x $b{y}} $x"
+
+	p := Tokenizer{}
+	n := p.Parse(strings.NewReader(src))
+	ex := Executor{Funcs: reg, Workers: 4}
+	if err := ex.Execute(n); err != nil {
+		t.Fatalf("parallel execution failed: %v", err)
+	}
+	sb := &strings.Builder{}
+	RenderHTML(sb, n)
+	if want := "<root><div><strong>X</strong> <strong>y</strong></div> <strong>X</strong></root>"; sb.String() != want {
+		t.Errorf("got %s want %s", sb.String(), want)
+	}
+}
+
+// a macro that shadows a concurrent function is used, as in serial execution
+func TestExecuteParallelShadowedByMacro(t *testing.T) {
+	reg := Builtins().Overlay().Register("b", MakeTag("strong"), WithConcurrent())
+	src := "$define[b]{MACRO $body}$div{$b{y}}"
+
+	p := Tokenizer{}
+	n := p.Parse(strings.NewReader(src))
+	ex := Executor{Funcs: reg, Workers: 4}
+	if err := ex.Execute(n); err != nil {
+		t.Fatalf("parallel execution failed: %v", err)
+	}
+	sb := &strings.Builder{}
+	RenderHTML(sb, n)
+	if want := "<root><div>MACRO y</div></root>"; sb.String() != want {
+		t.Errorf("got %s want %s", sb.String(), want)
+	}
+}
+
+func TestExecuteParallelDocumentOrder(t *testing.T) {
+	// $count is not concurrent and looks at the whole document
+	count := func(n *html.Node) error {
+		root := n
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		done := len(Selector(root, func(n *html.Node) bool { return n.Data == "code" }))
+		Replace(n, NewText(strconv.Itoa(done)))
+		return nil
+	}
+	reg := NewRegistry().
+		Register("c", MakeTag("code"), WithConcurrent()).
+		Register("count", count)
+
+	src := "$c{1} $count $c{2} $c{3} $p{$count} $c{4} $count"
+	serial := Tokenizer{}
+	want := serial.Parse(strings.NewReader(src))
+	if err := Execute(want, reg); err != nil {
+		t.Fatalf("serial execution failed: %v", err)
+	}
+
+	p := Tokenizer{}
+	got := p.Parse(strings.NewReader(src))
+	ex := Executor{Funcs: reg, Workers: 4}
+	if err := ex.Execute(got); err != nil {
+		t.Fatalf("parallel execution failed: %v", err)
+	}
+
+	sb1, sb2 := &strings.Builder{}, &strings.Builder{}
+	RenderHTMLFragment(sb1, want)
+	RenderHTMLFragment(sb2, got)
+	if sb1.String() != sb2.String() {
+		t.Errorf("parallel output differs:\n got %s\nwant %s", sb2.String(), sb1.String())
+	}
+	if want := "<code>1</code> 1 <code>2</code> <code>3</code> <p>3</p> <code>4</code> 4"; sb2.String() != want {
+		t.Errorf("expected %s, got %s", want, sb2.String())
+	}
+}
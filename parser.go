@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"log"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -23,20 +22,155 @@ func argToAttribute(arg string) html.Attribute {
 	}
 }
 
+// Position is a location in the source text
+type Position struct {
+	Offset int `json:"offset"` // byte offset, starting at 0
+	Line   int `json:"line"`   // line number, starting at 1
+	Column int `json:"column"` // column number in bytes, starting at 1
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// SourceMap records where each parsed node started in the source
+type SourceMap map[*html.Node]Position
+
+// Syntax is how an element was written in the source, see RenderSource
+type Syntax struct {
+	Head   string // "$name" or "$name[args]" exactly as written
+	Body   bool   // head was followed by "{"
+	Closed bool   // body ended with "}", and not the end of input
+
+	document bool             // the root made by Parse
+	name     string           // name as parsed
+	attr     []html.Attribute // args as parsed
+}
+
+// SyntaxMap records the original spelling of each parsed element
+type SyntaxMap map[*html.Node]*Syntax
+
+// QuoteMap records, for each parsed element with args, which of
+// its args were quoted in the source
+type QuoteMap map[*html.Node][]bool
+
 type Tokenizer struct {
+	// Positions, if non-nil, is filled with the starting position
+	// of every node that is parsed.
+	Positions SourceMap
+
+	// Quotes, if non-nil, is filled with which args were quoted
+	// for every element with args.
+	Quotes QuoteMap
+
+	// Syntax, if non-nil, is filled with the original spelling of
+	// every element that is parsed.  An unmatched "}" at the top level
+	// is then kept as text instead of being dropped.
+	Syntax SyntaxMap
+
 	r         io.ByteScanner
 	maybeText []byte
 	current   *html.Node
+
+	// position tracking
+	next      Position // position of the next byte to be read
+	last      Position // position of the byte just read
+	mark      Position // position of the last '$'
+	textStart Position // position of the first byte in maybeText
+
+	src []byte // bytes read, when recording syntax
 }
 
 func (z *Tokenizer) readByte() (byte, error) {
-	return z.r.ReadByte()
+	c, err := z.r.ReadByte()
+	if err != nil {
+		return c, err
+	}
+	if z.Syntax != nil {
+		z.src = append(z.src, c)
+	}
+	z.last = z.next
+	z.next.Offset++
+	z.next.Column++
+	if c == '\n' {
+		z.next.Line++
+		z.next.Column = 1
+	}
+	return c, nil
 }
 func (z *Tokenizer) unreadByte() {
 	if err := z.r.UnreadByte(); err != nil {
 		// should never happen
 		panic("asset failed: unread byte failed")
 	}
+	if z.Syntax != nil {
+		z.src = z.src[:len(z.src)-1]
+	}
+	z.next = z.last
+}
+
+// record saves the position of a node if tracking is enabled
+func (z *Tokenizer) record(n *html.Node, pos Position) {
+	if z.Positions != nil {
+		z.Positions[n] = pos
+	}
+}
+
+// appendArg adds the pending text as an arg of n
+func (z *Tokenizer) appendArg(n *html.Node, quoted bool) {
+	n.Attr = append(n.Attr, argToAttribute(string(z.maybeText)))
+	if z.Quotes != nil {
+		z.Quotes[n] = append(z.Quotes[n], quoted)
+	}
+}
+
+// recordSyntax saves the spelling of n, from the last '$' to end
+func (z *Tokenizer) recordSyntax(n *html.Node, end int, body bool) {
+	if z.Syntax == nil {
+		return
+	}
+	s := &Syntax{
+		Head: string(z.src[z.mark.Offset:end]),
+		Body: body,
+		name: n.Data,
+	}
+	if len(n.Attr) > 0 {
+		s.attr = make([]html.Attribute, len(n.Attr))
+		copy(s.attr, n.Attr)
+	}
+	z.Syntax[n] = s
+}
+
+// newElement creates an element node that started at the last '$'
+func (z *Tokenizer) newElement(name []byte) *html.Node {
+	n := &html.Node{
+		Type: html.ElementNode,
+		Data: string(name),
+	}
+	z.record(n, z.mark)
+	return n
+}
+
+// flushText appends any pending text as a text node to the current node
+func (z *Tokenizer) flushText() {
+	if len(z.maybeText) == 0 {
+		return
+	}
+	text := &html.Node{
+		Type: html.TextNode,
+		Data: string(z.maybeText),
+	}
+	z.record(text, z.textStart)
+	z.current.AppendChild(text)
+	z.maybeText = nil
+}
+
+// appendText adds bytes to the pending text, noting where it started
+func (z *Tokenizer) appendText(start Position, c ...byte) {
+	if len(z.maybeText) == 0 {
+		z.textStart = start
+	}
+	z.maybeText = append(z.maybeText, c...)
 }
 
 // Parse input into new root Node
@@ -45,6 +179,9 @@ func (z *Tokenizer) Parse(r io.Reader) *html.Node {
 		Type: html.ElementNode,
 		Data: "root",
 	}
+	if z.Syntax != nil {
+		z.Syntax[root] = &Syntax{document: true}
+	}
 	return z.ParseChildren(r, root)
 }
 
@@ -58,6 +195,8 @@ func (z *Tokenizer) ParseChildren(src io.Reader, root *html.Node) *html.Node {
 	z.maybeText = nil
 	z.r = r
 	z.current = root
+	z.next = Position{Line: 1, Column: 1}
+	z.src = nil
 	z.stateText()
 	return root
 }
@@ -66,39 +205,31 @@ func (z *Tokenizer) stateText() {
 	for {
 		c, err := z.readByte()
 		if err != nil {
-			if len(z.maybeText) == 0 {
-				return
-			}
 			// append final text node
-			text := &html.Node{
-				Type: html.TextNode,
-				Data: string(z.maybeText),
-			}
-			if z.current == nil {
-				panic("current is nil: adding " + text.Data)
-			}
-			z.current.AppendChild(text)
-			z.maybeText = nil
+			z.flushText()
 			return
 		}
 		switch c {
 		case '$':
+			z.mark = z.last
 			z.stateAfterDollar()
 		case '}':
-			if len(z.maybeText) > 0 {
-				// append final text node
-				text := &html.Node{
-					Type: html.TextNode,
-					Data: string(z.maybeText),
-				}
-				z.current.AppendChild(text)
-				z.maybeText = nil
+			if s := z.Syntax[z.current]; s != nil && s.document {
+				// unmatched, kept as text so RenderSource can
+				// reproduce it
+				z.appendText(z.last, c)
+				continue
+			}
+			// append final text node
+			z.flushText()
+			if s := z.Syntax[z.current]; s != nil {
+				s.Closed = true
 			}
 			if z.current.Parent != nil {
 				z.current = z.current.Parent
 			}
 		default:
-			z.maybeText = append(z.maybeText, c)
+			z.appendText(z.last, c)
 		}
 	}
 }
@@ -107,34 +238,21 @@ func (z *Tokenizer) stateAfterDollar() {
 	for {
 		c, err := z.readByte()
 		if err != nil {
-			z.maybeText = append(z.maybeText, '$')
+			z.appendText(z.mark, '$')
 			// append final text node
-			text := &html.Node{
-				Type: html.TextNode,
-				Data: string(z.maybeText),
-			}
-			z.current.AppendChild(text)
-			z.maybeText = nil
+			z.flushText()
 			return
 		}
 		switch c {
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '-', '+', '.', ',', ' ', '\t', '\r', '\f', '\n':
-			z.maybeText = append(z.maybeText, '$')
-			z.maybeText = append(z.maybeText, c)
+			z.appendText(z.mark, '$', c)
 			return
 		case '[':
 			// TBD
 		case '{':
-			log.Fatalf("Got '${', expected a function name")
+			panic(fmt.Errorf("%s: got '${', expected a function name", z.mark))
 		default:
-			if len(z.maybeText) > 0 {
-				text := &html.Node{
-					Type: html.TextNode,
-					Data: string(z.maybeText),
-				}
-				z.current.AppendChild(text)
-				z.maybeText = nil
-			}
+			z.flushText()
 			z.stateFunctionName(c)
 			return
 		}
@@ -147,11 +265,9 @@ func (z *Tokenizer) stateFunctionName(c byte) {
 		c, err := z.readByte()
 		if err != nil {
 			// $x is valid.. attach node
-			n := &html.Node{
-				Type: html.ElementNode,
-				Data: string(fname),
-			}
+			n := z.newElement(fname)
 			z.current.AppendChild(n)
+			z.recordSyntax(n, z.next.Offset, false)
 			return
 		}
 
@@ -160,36 +276,27 @@ func (z *Tokenizer) stateFunctionName(c byte) {
 		// probably an error
 		case '[':
 			// $foo[.... start of args.  Assume valid node
-			n := &html.Node{
-				Type: html.ElementNode,
-				Data: string(fname),
-			}
+			n := z.newElement(fname)
 			z.stateBeforeAttributeName(n)
 			return
 		case ' ', '\t', '\r', '\f', '\n':
 			// $FOO
-			n := &html.Node{
-				Type: html.ElementNode,
-				Data: string(fname),
-			}
+			n := z.newElement(fname)
 			z.current.AppendChild(n)
 			z.unreadByte()
+			z.recordSyntax(n, z.next.Offset, false)
 			return
-		case '$':
-			// $FOO$BAR
-			n := &html.Node{
-				Type: html.ElementNode,
-				Data: string(fname),
-			}
+		case '$', '}':
+			// $FOO$BAR or $b{$FOO}
+			n := z.newElement(fname)
 			z.current.AppendChild(n)
 			z.unreadByte()
+			z.recordSyntax(n, z.next.Offset, false)
 			return
 		case '{':
-			n := &html.Node{
-				Type: html.ElementNode,
-				Data: string(fname),
-			}
+			n := z.newElement(fname)
 			z.current.AppendChild(n)
+			z.recordSyntax(n, z.last.Offset, true)
 			z.current = n
 			z.stateText()
 			return
@@ -205,8 +312,6 @@ func (z *Tokenizer) stateBeforeAttributeName(n *html.Node) {
 		if err != nil {
 
 			panic(fmt.Errorf("stateBeforeAttributeName ran out of room in node %s", n.Data))
-			// TBD on what to do here
-			return
 		}
 
 		switch c {
@@ -216,7 +321,7 @@ func (z *Tokenizer) stateBeforeAttributeName(n *html.Node) {
 			// $foo[]....
 			//
 			if len(z.maybeText) > 0 {
-				n.Attr = append(n.Attr, argToAttribute(string(z.maybeText)))
+				z.appendArg(n, false)
 				z.maybeText = nil
 			}
 			z.stateAfterAttributes(n)
@@ -239,13 +344,11 @@ func (z *Tokenizer) stateAttributeNameQuote1(n *html.Node) {
 		c, err := z.readByte()
 		if err != nil {
 			panic(fmt.Errorf("stateAttributeNameQuote1 ran out of room in node %s", n.Data))
-			// TBD on what to do here
-			return
 		}
 
 		switch c {
 		case '\'':
-			n.Attr = append(n.Attr, argToAttribute(string(z.maybeText)))
+			z.appendArg(n, true)
 			z.maybeText = nil
 			return
 		default:
@@ -258,12 +361,11 @@ func (z *Tokenizer) stateAttributeNameQuote2(n *html.Node) {
 		c, err := z.readByte()
 		if err != nil {
 			panic(fmt.Errorf("stateAttributeNameQuote2 ran out of room in node %s", n.Data))
-			return
 		}
 
 		switch c {
 		case '"':
-			n.Attr = append(n.Attr, argToAttribute(string(z.maybeText)))
+			z.appendArg(n, true)
 			z.maybeText = nil
 			return
 		default:
@@ -277,25 +379,26 @@ func (z *Tokenizer) stateAttributeName(n *html.Node) {
 		c, err := z.readByte()
 		if err != nil {
 			panic("stateAttributeName ran out of room")
-			// TBD on what to do here
-			return
 		}
 
 		switch c {
 		case ' ', '\t', '\f', '\r', '\n':
 			// $foo[xxxi<sp>
-			n.Attr = append(n.Attr, argToAttribute(string(z.maybeText)))
+			z.appendArg(n, false)
 			z.maybeText = nil
 			return
 		case '\'':
+			// $foo[key='value'], the quote ends the arg
 			z.stateAttributeNameQuote1(n)
+			return
 		case '"':
 			z.stateAttributeNameQuote2(n)
+			return
 		case ']':
 			// $foo[]....
 			//
 			if len(z.maybeText) > 0 {
-				n.Attr = append(n.Attr, argToAttribute(string(z.maybeText)))
+				z.appendArg(n, false)
 			}
 			z.maybeText = nil
 			z.unreadByte()
@@ -310,7 +413,6 @@ func (z *Tokenizer) stateAfterAttributeValueQuoted() {
 	c, err := z.readByte()
 	if err != nil {
 		panic("stateAfterAttributeValueQuoted ran out of room")
-		return
 	}
 
 	switch c {
@@ -328,16 +430,20 @@ func (z *Tokenizer) stateAfterAttributeValueQuoted() {
 
 func (z *Tokenizer) stateAfterAttributes(n *html.Node) {
 	z.current.AppendChild(n)
+	end := z.next.Offset
 
 	c, err := z.readByte()
 	if err != nil {
 		// exactly $foo[...]<EOF>
+		z.recordSyntax(n, end, false)
 		return
 	}
 	switch c {
 	case '{':
+		z.recordSyntax(n, end, true)
 		z.current = n
 		return
 	}
 	z.unreadByte()
+	z.recordSyntax(n, end, false)
 }
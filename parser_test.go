@@ -1,8 +1,11 @@
 package tagfunctions
 
 import (
+	"reflect"
 	"strings"
 	"testing"
+
+	"golang.org/x/net/html"
 )
 
 func TestMacro2(t *testing.T) {
@@ -45,6 +48,7 @@ func TestMacro2(t *testing.T) {
 		{`$b[class='mega']{bold}`, `$root{$b[class=mega]{bold}}`},
 		{`$b[class='mega bold']{bold}`, `$root{$b[class="mega bold"]{bold}}`},
 		{`$b[class="mega bold"]{bold}`, `$root{$b[class="mega bold"]{bold}}`},
+		{`$b[class="mega bold" id=x]{bold}`, `$root{$b[class="mega bold" id=x]{bold}}`},
 		{`$b["1" "2" "3"]`, `$root{$b[1 2 3]}`},
 		{`$b['1' '2' '3']`, `$root{$b[1 2 3]}`},
 
@@ -92,3 +96,80 @@ func TestQuotedAttributeName(t *testing.T) {
 	}
 }
 */
+
+// a "}" ends a function name, and closes the enclosing body, so a
+// bare $name can be the last thing in a body, as in a macro template
+func TestNameEndsAtBrace(t *testing.T) {
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$b{x $i}", "$root{$b{x $i{}}}"},
+		{"$b{$i}y", "$root{$b{$i{}}y}"},
+		{"$b{$i$u}", "$root{$b{$i{}$u{}}}"},
+		{"$define[x]{$a[href=$1]{$body}}", "$root{$define[x]{$a[href=$1]{$body{}}}}"},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		node := p.Parse(strings.NewReader(tc.input))
+		sb := &strings.Builder{}
+		if err := Render(sb, node); err != nil {
+			t.Errorf("case %d: got unexpected error %v", i, err)
+		}
+		if got := sb.String(); got != tc.want {
+			t.Errorf("case %d: %s: expected %v, got %v", i, tc.input, tc.want, got)
+		}
+	}
+}
+
+// a closing quote ends the arg, so what follows is a new arg
+// and not an empty one
+func TestQuotedValueArgs(t *testing.T) {
+	type test struct {
+		input string
+		want  []html.Attribute
+	}
+	tests := []test{
+		{`$b[class="a b" id=x]`, []html.Attribute{{Key: "class", Val: "a b"}, {Key: "id", Val: "x"}}},
+		{`$b[class='a b'  id=x ]`, []html.Attribute{{Key: "class", Val: "a b"}, {Key: "id", Val: "x"}}},
+		{`$b[k="v"]`, []html.Attribute{{Key: "k", Val: "v"}}},
+		{`$b[k="v" "w x"]`, []html.Attribute{{Key: "k", Val: "v"}, {Key: "w x"}}},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{Quotes: QuoteMap{}}
+		n := p.Parse(strings.NewReader(tc.input)).FirstChild
+		if !reflect.DeepEqual(n.Attr, tc.want) {
+			t.Errorf("case %d: %s: expected %v, got %v", i, tc.input, tc.want, n.Attr)
+		}
+		if q := p.Quotes[n]; len(q) != len(tc.want) || !q[0] {
+			t.Errorf("case %d: %s: unexpected quotes %v", i, tc.input, q)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	p := Tokenizer{Positions: SourceMap{}}
+	root := p.Parse(strings.NewReader("ab\n$b{bold}\n $i[x]"))
+
+	// text "ab\n", $b, text "\n ", $i
+	want := []Position{
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 3, Line: 2, Column: 1},
+		{Offset: 11, Line: 2, Column: 9},
+		{Offset: 13, Line: 3, Column: 2},
+	}
+	i := 0
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if i >= len(want) {
+			t.Fatalf("too many children")
+		}
+		if got := p.Positions[c]; got != want[i] {
+			t.Errorf("child %d: got %+v want %+v", i, got, want[i])
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Errorf("got %d children want %d", i, len(want))
+	}
+}
@@ -0,0 +1,273 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultTextWidth is the line width used by RenderText if none is set
+const DefaultTextWidth = 72
+
+// TextOptions controls RenderText
+type TextOptions struct {
+	// Width is the maximum line length for wrapped text.
+	// If zero, DefaultTextWidth is used.  If negative, text is not wrapped.
+	Width int
+}
+
+// RenderText renders an executed tree as plain text, such as for email.
+//
+// Paragraphs are wrapped and separated by blank lines, headings are
+// underlined, list items get bullets or numbers and tables are laid out
+// in aligned columns.  Links are written as footnote references, with
+// the URLs listed at the end.  The root element is not rendered.
+func RenderText(w io.Writer, n *html.Node, opts TextOptions) error {
+	width := opts.Width
+	if width == 0 {
+		width = DefaultTextWidth
+	}
+	tr := &textRenderer{}
+	blocks := topBlock(n,
+		func(n *html.Node) string { return tr.block(n, width) },
+		func(n *html.Node) string { return wrapText(tr.inline(n), width) })
+	if len(tr.links) > 0 {
+		notes := make([]string, len(tr.links))
+		for i, link := range tr.links {
+			notes[i] = fmt.Sprintf("[%d] %s", i+1, link)
+		}
+		blocks = append(blocks, strings.Join(notes, "\n"))
+	}
+	return writeBlocks(w, blocks)
+}
+
+type textRenderer struct {
+	links []string // footnotes, in order of appearance
+}
+
+// blocks converts the children of n to blocks.  Runs of inline nodes are
+// combined into a paragraph.
+func (tr *textRenderer) blocks(n *html.Node, width int) []string {
+	var blocks []string
+	var inline []*html.Node
+	flush := func() {
+		if len(inline) == 0 {
+			return
+		}
+		if text := wrapText(tr.inlines(inline), width); text != "" {
+			blocks = append(blocks, text)
+		}
+		inline = nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBlockElement(c) {
+			inline = append(inline, c)
+			continue
+		}
+		flush()
+		if b := tr.block(c, width); b != "" {
+			blocks = append(blocks, b)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func (tr *textRenderer) block(n *html.Node, width int) string {
+	switch n.Data {
+	case "p":
+		return wrapText(tr.children(n), width)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := wrapText(tr.children(n), width)
+		if text == "" {
+			return ""
+		}
+		underline := "-"
+		if n.Data == "h1" {
+			underline = "="
+		}
+		longest := 0
+		for _, line := range strings.Split(text, "\n") {
+			longest = max(longest, utf8.RuneCountInString(line))
+		}
+		return text + "\n" + strings.Repeat(underline, longest)
+	case "hr":
+		if width < 0 {
+			return strings.Repeat("-", DefaultTextWidth)
+		}
+		return strings.Repeat("-", width)
+	case "pre":
+		return strings.TrimRight(TextContent(n), "\n")
+	case "blockquote":
+		text := strings.Join(tr.blocks(n, narrow(width, 2)), "\n\n")
+		return prefixLines(text, "> ", ">")
+	case "ul", "ol":
+		return tr.list(n, width)
+	case "table":
+		return tr.table(n)
+	}
+	// div, section and other containers
+	return strings.Join(tr.blocks(n, width), "\n\n")
+}
+
+// list numbers or bullets each item and indents the rest of its lines
+func (tr *textRenderer) list(n *html.Node, width int) string {
+	var items []string
+	for _, item := range listEntries(n, "* ") {
+		if item.node.Type != html.ElementNode {
+			items = append(items, strings.TrimSpace(TextContent(item.node)))
+			continue
+		}
+		items = append(items, item.join(tr.blocks(item.node, narrow(width, len(item.marker)))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table lays out the cells in columns.  A header row is underlined.
+// The caption is on its own line above, and does not affect the columns.
+func (tr *textRenderer) table(n *html.Node) string {
+	cells, extra := tableRows(n)
+	var captions []string
+	for _, c := range extra {
+		if c.Data != "caption" {
+			continue
+		}
+		if text := strings.TrimSpace(tr.children(c)); text != "" {
+			captions = append(captions, strings.ReplaceAll(text, "\n", " "))
+		}
+	}
+	rows := make([][]string, len(cells))
+	for i, row := range cells {
+		for _, cell := range row {
+			text := strings.TrimSpace(tr.children(cell))
+			rows[i] = append(rows[i], strings.ReplaceAll(text, "\n", " "))
+		}
+	}
+	header := tableHeader(cells)
+
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	line := func(row []string) string {
+		sb := strings.Builder{}
+		for i, cell := range row {
+			if i > 0 {
+				sb.WriteString("  ")
+			}
+			sb.WriteString(cell)
+			if i < len(row)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			}
+		}
+		return strings.TrimRight(sb.String(), " ")
+	}
+	lines := captions
+	for i, row := range rows {
+		lines = append(lines, line(row))
+		if i == 0 && header {
+			rule := make([]string, len(widths))
+			for j, w := range widths {
+				rule[j] = strings.Repeat("-", w)
+			}
+			lines = append(lines, line(rule))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (tr *textRenderer) children(n *html.Node) string {
+	var nodes []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+	return tr.inlines(nodes)
+}
+
+func (tr *textRenderer) inlines(nodes []*html.Node) string {
+	sb := strings.Builder{}
+	for _, n := range nodes {
+		sb.WriteString(tr.inline(n))
+	}
+	return sb.String()
+}
+
+// inline returns the text of an inline node.  Line breaks are "\n",
+// all other whitespace is collapsed.
+func (tr *textRenderer) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return whitespaceRegexp.ReplaceAllString(n.Data, " ")
+	case html.RawNode:
+		// entities from $entity
+		return html.UnescapeString(n.Data)
+	case html.ElementNode:
+		// below
+	default:
+		return ""
+	}
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "img":
+		if alt := GetAttr(n, "alt"); alt != "" {
+			return "[" + alt + "]"
+		}
+		return ""
+	case "a":
+		text := tr.children(n)
+		href := GetAttr(n, "href")
+		if href == "" || href == strings.TrimSpace(text) {
+			return text
+		}
+		tr.links = append(tr.links, href)
+		return fmt.Sprintf("%s[%d]", text, len(tr.links))
+	}
+	return tr.children(n)
+}
+
+// wrapText fills each line of text to width.  Lines are only broken
+// at spaces, so a long word may exceed the width.
+func wrapText(text string, width int) string {
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		words := strings.Fields(line)
+		if width < 0 {
+			out = append(out, strings.Join(words, " "))
+			continue
+		}
+		current, n := "", 0
+		for _, word := range words {
+			wn := utf8.RuneCountInString(word)
+			switch {
+			case n == 0:
+				current, n = word, wn
+			case n+1+wn > width:
+				out = append(out, current)
+				current, n = word, wn
+			default:
+				current += " " + word
+				n += 1 + wn
+			}
+		}
+		out = append(out, current)
+	}
+	return strings.Trim(strings.Join(out, "\n"), "\n")
+}
+
+// narrow reduces the width for indented content, leaving "no wrapping"
+// alone and always leaving some room.
+func narrow(width, indent int) int {
+	if width < 0 {
+		return width
+	}
+	return max(width-indent, 1)
+}
@@ -0,0 +1,93 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderText(t *testing.T) {
+	type test struct {
+		input string
+		width int
+		want  string
+	}
+
+	tests := []test{
+		{"", 0, ""},
+		{"$p{hello\n   world}", 0, "hello world\n"},
+		{"$p{one}$p{two}", 0, "one\n\ntwo\n"},
+		{"$h1{Title}$h2{Sub}", 0, "Title\n=====\n\nSub\n---\n"},
+		{"$p{the quick brown fox jumps}", 10, "the quick\nbrown fox\njumps\n"},
+		{"$p{the quick brown fox jumps}", -1, "the quick brown fox jumps\n"},
+		{"$p{$b{bold} and $i{italic}}", 0, "bold and italic\n"},
+		{"$p{line$br{}next}", 0, "line\nnext\n"},
+		{"$p{a $entity[amp] b}", 0, "a & b\n"},
+		{`$p{see $a[href="http://a.com"]{here} and $a[href="http://b.com"]{there}}`, 0,
+			"see here[1] and there[2]\n\n[1] http://a.com\n[2] http://b.com\n"},
+		{`$p{$a[href="http://a.com"]{http://a.com}}`, 0, "http://a.com\n"},
+		{"$ul{$li{one} $li{two}}", 0, "* one\n* two\n"},
+		{"$ol[start=9]{$li{nine}$li{ten}}", 0, "9. nine\n10. ten\n"},
+		{"$ul{$li{aaa bbb ccc}}", 7, "* aaa\n  bbb\n  ccc\n"},
+		{"$ul{$li{one $ul{$li{nested}}}}", 0, "* one\n  * nested\n"},
+		{"$blockquote{$p{aaa bbb}}", 5, "> aaa\n> bbb\n"},
+		{"$pre{  x := 1\n  y := 2\n}", 0, "  x := 1\n  y := 2\n"},
+		{"$hr{}", 5, "-----\n"},
+		{"$table{$tr{$td{a}$td{bbb}$td{c}}$tr{$td{dddd}$td{e}$td{f}}}", 0, "a     bbb  c\ndddd  e    f\n"},
+		{"$table{$caption{A long caption}$tr{$th{a}$th{b}}$tr{$td{1}$td{2}}}", 0, "A long caption\na  b\n-  -\n1  2\n"},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		node := p.Parse(strings.NewReader(tc.input))
+		reg := NewRegistry().Register("entity", Entity)
+		if err := Execute(node, reg); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		sb := strings.Builder{}
+		if err := RenderText(&sb, node, TextOptions{Width: tc.width}); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if got := sb.String(); got != tc.want {
+			t.Errorf("case %d: %q: expected %q, got %q", i, tc.input, tc.want, got)
+		}
+	}
+}
+
+func TestRenderTextCsvTable(t *testing.T) {
+	src := "$csvtable{name,count\napples,10\nkiwi,2\n}"
+	reg := NewRegistry().Register("csvtable", NewCsvTableHTML(nil))
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader(src))
+	if err := Execute(node, reg); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	sb := strings.Builder{}
+	if err := RenderText(&sb, node, TextOptions{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := "name    count\n------  -----\napples  10\nkiwi    2\n"
+	if sb.String() != want {
+		t.Errorf("got %q want %q", sb.String(), want)
+	}
+}
+
+func TestRenderTextSiblings(t *testing.T) {
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader(`$a[href="http://a.com"]{one} $p{two} three`))
+	for i, tc := range []struct {
+		n    *html.Node
+		want string
+	}{
+		{node.FirstChild, "one[1]\n\n[1] http://a.com\n"},
+		{node.FirstChild.NextSibling.NextSibling, "two\n"},
+	} {
+		sb := strings.Builder{}
+		if err := RenderText(&sb, tc.n, TextOptions{}); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if sb.String() != tc.want {
+			t.Errorf("case %d: expected %q, got %q", i, tc.want, sb.String())
+		}
+	}
+}
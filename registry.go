@@ -0,0 +1,172 @@
+package tagfunctions
+
+import (
+	"sort"
+)
+
+// Entry is a registered function and its metadata
+type Entry struct {
+	Name        string
+	Func        NodeFunc
+	ContextFunc ContextFunc // used instead of Func if set
+	Doc         string
+	Schema      *Schema // optional, checked before Func is called
+
+	// Concurrent is true if the function may run in parallel,
+	// see WithConcurrent.
+	Concurrent bool
+
+	// RawBody is true if the children are not executed before the
+	// function is called, see WithRawBody.
+	RawBody bool
+}
+
+// Option configures an Entry during registration
+type Option func(*Entry)
+
+// WithDoc attaches documentation to a function
+func WithDoc(doc string) Option {
+	return func(e *Entry) {
+		e.Doc = doc
+	}
+}
+
+// Registry maps function names to NodeFuncs.
+//
+// A Registry may be an overlay on a parent registry:  names not found
+// are looked up in the parent.  This allows a per-document registry
+// to add or replace functions without changing a site-wide one.
+//
+// The zero Registry is empty and ready to use.  A nil *Registry is
+// also empty, and may be looked up and overlaid, but functions can not
+// be added to it.  A Registry is safe for concurrent lookups, but not
+// for concurrent registration.
+type Registry struct {
+	parent *Registry
+	funcs  map[string]*Entry
+	text   []*TextEntry
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		funcs: make(map[string]*Entry),
+	}
+}
+
+// NewRegistryFromMap returns a registry containing the functions in m
+func NewRegistryFromMap(m map[string]NodeFunc) *Registry {
+	r := NewRegistry()
+	for name, fn := range m {
+		r.Register(name, fn)
+	}
+	return r
+}
+
+// Register adds or replaces a function, and returns the registry for chaining
+func (r *Registry) Register(name string, fn NodeFunc, opts ...Option) *Registry {
+	e := &Entry{
+		Name: name,
+		Func: fn,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	r.set(name, e)
+	return r
+}
+
+// RegisterContext adds or replaces a function that needs the execution context
+func (r *Registry) RegisterContext(name string, fn ContextFunc, opts ...Option) *Registry {
+	e := &Entry{
+		Name:        name,
+		ContextFunc: fn,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	r.set(name, e)
+	return r
+}
+
+// set adds an entry, creating the map for a zero Registry
+func (r *Registry) set(name string, e *Entry) {
+	if r.funcs == nil {
+		r.funcs = make(map[string]*Entry)
+	}
+	r.funcs[name] = e
+}
+
+// RegisterPrefix adds every function in src under the name prefix+name.
+//
+// This is used to namespace a set of functions, e.g. with a prefix of
+// "math." the function "sum" is registered as "math.sum".
+func (r *Registry) RegisterPrefix(prefix string, src *Registry) *Registry {
+	for _, name := range src.Names() {
+		e, _ := src.Lookup(name)
+		tmp := *e
+		tmp.Name = prefix + name
+		r.set(tmp.Name, &tmp)
+	}
+	return r
+}
+
+// Lookup finds a function by name, checking parent registries if needed.
+func (r *Registry) Lookup(name string) (*Entry, bool) {
+	for ; r != nil; r = r.parent {
+		if e, ok := r.funcs[name]; ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Merge copies every function and text function visible in src into r,
+// replacing any with the same name.
+func (r *Registry) Merge(src *Registry) *Registry {
+	for _, name := range src.Names() {
+		e, _ := src.Lookup(name)
+		r.set(name, e)
+	}
+	for _, te := range src.TextFuncs() {
+		r.addText(te)
+	}
+	return r
+}
+
+// Clone returns a copy of the registry.  The copy shares the same parent.
+func (r *Registry) Clone() *Registry {
+	out := NewRegistry()
+	if r == nil {
+		return out
+	}
+	out.parent = r.parent
+	for name, e := range r.funcs {
+		out.funcs[name] = e
+	}
+	out.text = append(out.text, r.text...)
+	return out
+}
+
+// Overlay returns a new empty registry that falls back to r
+func (r *Registry) Overlay() *Registry {
+	out := NewRegistry()
+	out.parent = r
+	return out
+}
+
+// Names returns the sorted names of all visible functions
+func (r *Registry) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for ; r != nil; r = r.parent {
+		for name := range r.funcs {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,84 @@
+package tagfunctions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistryOverlay(t *testing.T) {
+	site := NewRegistry().
+		Register("b", MakeTag("strong"), WithDoc("bold text")).
+		Register("i", MakeTag("em"))
+
+	doc := site.Overlay().Register("i", MakeTag("i"))
+
+	got, err := GenerateHTML("$b{bold} $i{italic}", doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "<strong>bold</strong> <i>italic</i>"; got != want {
+		t.Errorf("overlay: got %s want %s", got, want)
+	}
+
+	// parent is unchanged
+	got, err = GenerateHTML("$b{bold} $i{italic}", site)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "<strong>bold</strong> <em>italic</em>"; got != want {
+		t.Errorf("site: got %s want %s", got, want)
+	}
+
+	e, ok := doc.Lookup("b")
+	if !ok || e.Doc != "bold text" {
+		t.Errorf("lookup through overlay failed: %v", e)
+	}
+}
+
+func TestRegistryPrefixMergeClone(t *testing.T) {
+	math := NewRegistry().
+		Register("sum", MakeTag("span")).
+		Register("max", MakeTag("span"))
+
+	r := NewRegistry().RegisterPrefix("math.", math)
+	if want, got := []string{"math.max", "math.sum"}, r.Names(); !reflect.DeepEqual(want, got) {
+		t.Errorf("prefix: got %v want %v", got, want)
+	}
+
+	c := r.Clone().Merge(math)
+	if want, got := []string{"math.max", "math.sum", "max", "sum"}, c.Names(); !reflect.DeepEqual(want, got) {
+		t.Errorf("merge: got %v want %v", got, want)
+	}
+	if len(r.Names()) != 2 {
+		t.Errorf("clone modified original: %v", r.Names())
+	}
+
+	var empty *Registry
+	if _, ok := empty.Lookup("x"); ok {
+		t.Errorf("nil registry should be empty")
+	}
+}
+
+func TestRegistryZeroAndNil(t *testing.T) {
+	var zero Registry
+	zero.Register("b", MakeTag("strong"))
+	zero.RegisterContext("v", VarFunc)
+	if _, ok := zero.Lookup("b"); !ok {
+		t.Errorf("register on zero Registry failed")
+	}
+	if names := zero.Names(); !reflect.DeepEqual(names, []string{"b", "v"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	var none *Registry
+	if _, ok := none.Lookup("b"); ok || len(none.Names()) != 0 {
+		t.Errorf("nil Registry is not empty")
+	}
+	got, err := GenerateHTML("$b{x}", none.Overlay().Register("b", MakeTag("strong")))
+	if err != nil || got != "<strong>x</strong>" {
+		t.Errorf("overlay on nil Registry: got %q %v", got, err)
+	}
+	if (&Registry{}).Merge(none).Names() != nil {
+		t.Errorf("merge of nil Registry is not empty")
+	}
+}
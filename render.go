@@ -22,9 +22,49 @@ func RenderStringFunc(render func(io.Writer, *html.Node) error) func(n *html.Nod
 }
 
 // Render AST into HTML
+//
+// Args without a value that are not boolean HTML attributes, such as
+// the 1 and 2 in $echo[1 2], are dropped, as are attributes with invalid
+// names.  Earlier versions wrote them as empty attributes, as in
+// <echo 1="" 2="">; use HTMLRenderer with PositionalKeep to keep them.
+//
+// n itself is rendered, so the root from Tokenizer.Parse is written as
+// <root>...</root>.  GenerateHTML and Engine no longer include it, see
+// RenderHTMLFragment; set Engine.Render to RenderHTML for the old output.
 func RenderHTML(w io.Writer, n *html.Node) error {
-	// not much to do here!
-	return html.Render(w, n)
+	return (&HTMLRenderer{}).Render(w, n)
+}
+
+// RenderHTMLFragment renders the children of n, but not n itself.
+//
+// Use this on the root node returned by Tokenizer.Parse to get the
+// document without the <root> wrapper.
+func RenderHTMLFragment(w io.Writer, n *html.Node) error {
+	return (&HTMLRenderer{}).RenderFragment(w, n)
+}
+
+// RenderHTMLDocument renders the children of n as a complete HTML5
+// document.  The title and lang values of the front matter, if any, are
+// used for the <title> and <html lang="...">.
+func RenderHTMLDocument(w io.Writer, n *html.Node, fm FrontMatter) error {
+	sb := &strings.Builder{}
+	sb.WriteString("<!DOCTYPE html>\n")
+	if lang := fm.String("lang"); lang != "" {
+		sb.WriteString(`<html lang="` + html.EscapeString(lang) + `">`)
+	} else {
+		sb.WriteString("<html>")
+	}
+	sb.WriteString("\n<head>\n<meta charset=\"utf-8\">\n")
+	if title := fm.String("title"); title != "" {
+		sb.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	}
+	sb.WriteString("</head>\n<body>\n")
+	if err := RenderHTMLFragment(sb, n); err != nil {
+		return err
+	}
+	sb.WriteString("\n</body>\n</html>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
 }
 
 // hack used in many places in go
@@ -122,3 +162,101 @@ func render1(w writer, n *html.Node) error {
 	}
 	return w.WriteByte('}')
 }
+
+// RenderSource renders a parsed tree back to source, keeping the
+// original spelling recorded by a Tokenizer with Syntax set.
+//
+// Elements whose name and args are unchanged are written exactly as in
+// the source, so a document that is not modified renders byte for byte
+// the same, including an unmatched "}".  Text is always written as is.
+// New or changed elements are rendered with canonical quoting, as by
+// Format.  The root made by Parse is not written, only its children.
+func RenderSource(w io.Writer, n *html.Node, syntax SyntaxMap) error {
+	buf := &bytes.Buffer{}
+	if err := renderSource(buf, n, syntax); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func renderSource(buf *bytes.Buffer, n *html.Node, syntax SyntaxMap) error {
+	if n.Type != html.ElementNode {
+		return formatNode(buf, n)
+	}
+	s := syntax[n]
+	if s != nil && s.document {
+		return renderSourceChildren(buf, n, syntax)
+	}
+	if s == nil || !s.unchanged(n) {
+		return renderSourceElement(buf, n, syntax)
+	}
+
+	buf.WriteString(s.Head)
+	if !s.Body && n.FirstChild == nil {
+		// $name or $name[args] with nothing after, keep it that
+		// way unless what follows would be read as part of it
+		if next := n.NextSibling; next != nil && next.Type == html.TextNode && next.Data != "" {
+			c := next.Data[0]
+			if c == '{' || (len(n.Attr) == 0 && !strings.ContainsRune(" \t\r\f\n$}", rune(c))) {
+				buf.WriteString("{}")
+			}
+		}
+		return nil
+	}
+	buf.WriteByte('{')
+	if err := renderSourceChildren(buf, n, syntax); err != nil {
+		return err
+	}
+	// only a body that was left open in the source may stay open
+	if s.Closed || !s.Body || !atEnd(n) {
+		buf.WriteByte('}')
+	}
+	return nil
+}
+
+// renderSourceElement is like formatNode, keeping the spelling of children
+func renderSourceElement(buf *bytes.Buffer, n *html.Node, syntax SyntaxMap) error {
+	if body, err := formatHead(buf, n); !body || err != nil {
+		return err
+	}
+	buf.WriteByte('{')
+	if err := renderSourceChildren(buf, n, syntax); err != nil {
+		return err
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func renderSourceChildren(buf *bytes.Buffer, n *html.Node, syntax SyntaxMap) error {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := renderSource(buf, c, syntax); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unchanged returns true if the name and args of n are as parsed
+func (s *Syntax) unchanged(n *html.Node) bool {
+	if n.Data != s.name || len(n.Attr) != len(s.attr) {
+		return false
+	}
+	for i, a := range n.Attr {
+		if a != s.attr[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// atEnd returns true if nothing follows n or any of its ancestors,
+// so an unclosed body may stay unclosed
+func atEnd(n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n.NextSibling != nil {
+			return false
+		}
+	}
+	return true
+}
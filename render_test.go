@@ -3,6 +3,8 @@ package tagfunctions
 import (
 	"strings"
 	"testing"
+
+	"golang.org/x/net/html"
 )
 
 // tests identity  orig -> parse -> render -> orig
@@ -18,7 +20,8 @@ func TestRender(t *testing.T) {
 		{"$b{bold} text", "<b>bold</b> text"},
 		{"$b{bold $i{italic} text}", "<b>bold <i>italic</i> text</b>"},
 		{"$p[class=text]{body}", `<p class="text">body</p>`},
-		{"$echo[1 2 3 4]", `<echo 1="" 2="" 3="" 4=""></echo>`},
+		{"$echo[1 2 3 4]", `<echo></echo>`},
+		{"$input[disabled type=checkbox]", `<input disabled="" type="checkbox"/>`},
 	}
 	for i, tc := range tests {
 
@@ -45,3 +48,141 @@ func TestRender(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderHTMLFragment(t *testing.T) {
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader("$b{bold} & text"))
+	sb := &strings.Builder{}
+	if err := RenderHTMLFragment(sb, node); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "<b>bold</b> &amp; text"; sb.String() != want {
+		t.Errorf("got %s want %s", sb.String(), want)
+	}
+}
+
+func TestRenderHTMLDocument(t *testing.T) {
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader("$p{hello}"))
+	sb := &strings.Builder{}
+	fm := FrontMatter{"title": "A & B", "lang": "en"}
+	if err := RenderHTMLDocument(sb, node, fm); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>A &amp; B</title>
+</head>
+<body>
+<p>hello</p>
+</body>
+</html>
+`
+	if sb.String() != want {
+		t.Errorf("got %s want %s", sb.String(), want)
+	}
+
+	// no front matter
+	e := Engine{Document: true}
+	res, err := e.Process("text")
+	if err != nil || !strings.Contains(res.Output, "<html>\n<head>\n<meta charset=\"utf-8\">\n</head>\n<body>\ntext\n") {
+		t.Errorf("got %q %v", res.Output, err)
+	}
+}
+func TestRenderSourceUnchanged(t *testing.T) {
+	tests := []string{
+		"",
+		"plain text",
+		"$b{bold $i{italic}} text",
+		"$a[ href='x y'   \"two words\"\tplain ]{link}",
+		"$echo[1 2 3]after",
+		"$foo$bar next",
+		"$x",
+		"$b{x $i}",
+		"$1.00 and $ alone",
+		"$ul{\n  $li{a}\n\n\t$li{b}\n}\n",
+		"$p{unclosed $b{at end",
+		"$img[src=a]",
+		"a}b",
+		"$a[x]{y}}z",
+		"}",
+	}
+	for i, src := range tests {
+		z := Tokenizer{Syntax: SyntaxMap{}}
+		node := z.Parse(strings.NewReader(src))
+		sb := &strings.Builder{}
+		if err := RenderSource(sb, node, z.Syntax); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if sb.String() != src {
+			t.Errorf("case %d: expected %q, got %q", i, src, sb.String())
+		}
+	}
+}
+
+func TestRenderSourceModified(t *testing.T) {
+	src := "Intro.\n\n$p{See $a[ href='http://old.com'  class=x ]{the   site} and $b[ id=1 ]{bold}.}\n$hr\n"
+	z := Tokenizer{Syntax: SyntaxMap{}}
+	node := z.Parse(strings.NewReader(src))
+
+	// change one link, add a child to a bare element, and add a new one
+	links := Selector(node, func(n *html.Node) bool { return n.Data == "a" })
+	links[0].Attr[0].Val = "http://new.com"
+	hr := Selector(node, func(n *html.Node) bool { return n.Data == "hr" })[0]
+	hr.AppendChild(NewText("x"))
+	Append(node, NewElement("i", "title", "new one"))
+
+	sb := &strings.Builder{}
+	if err := RenderSource(sb, node, z.Syntax); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := "Intro.\n\n$p{See $a[href=http://new.com class=x]{the   site} and $b[ id=1 ]{bold}.}\n$hr{x}\n$i[title=\"new one\"]"
+	if sb.String() != want {
+		t.Errorf("expected %q, got %q", want, sb.String())
+	}
+
+	// children added to a bare element are closed
+	for _, tc := range [][2]string{
+		{"$hr", "$hr{x}"},
+		{"$a[x]", "$a[x]{x}"},
+		{"$p{x $hr}", "$p{x $hr{x}}"},
+	} {
+		z = Tokenizer{Syntax: SyntaxMap{}}
+		node = z.Parse(strings.NewReader(tc[0]))
+		bare := Selector(node, func(n *html.Node) bool { return n.Data == "hr" || n.Data == "a" })[0]
+		bare.AppendChild(NewText("x"))
+		sb.Reset()
+		if err := RenderSource(sb, node, z.Syntax); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if sb.String() != tc[1] {
+			t.Errorf("%s: expected %q, got %q", tc[0], tc[1], sb.String())
+		}
+	}
+
+	// a bare element must not run into new text
+	z = Tokenizer{Syntax: SyntaxMap{}}
+	node = z.Parse(strings.NewReader("$br"))
+	Append(node, NewText("text"))
+	sb.Reset()
+	if err := RenderSource(sb, node, z.Syntax); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "$br{}text"; sb.String() != want {
+		t.Errorf("expected %q, got %q", want, sb.String())
+	}
+
+	// an unclosed body is closed once something follows it
+	z = Tokenizer{Syntax: SyntaxMap{}}
+	node = z.Parse(strings.NewReader("$b{bold"))
+	Append(node, NewText(" after"))
+	sb.Reset()
+	if err := RenderSource(sb, node, z.Syntax); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "$b{bold} after"; sb.String() != want {
+		t.Errorf("expected %q, got %q", want, sb.String())
+	}
+}
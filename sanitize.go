@@ -0,0 +1,177 @@
+package tagfunctions
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SanitizePolicy is an allowlist of elements, attributes and URL schemes
+// for rendering untrusted documents.
+type SanitizePolicy struct {
+	// Elements maps each allowed element to its allowed attributes
+	Elements map[string][]string
+
+	// GlobalAttrs are allowed on every allowed element
+	GlobalAttrs []string
+
+	// URLAttrs are attributes holding a URL.  Absolute URLs must use
+	// one of URLSchemes, relative URLs are always allowed.
+	URLAttrs   []string
+	URLSchemes []string
+
+	// Drop lists elements that are removed along with their content.
+	// Other elements that are not allowed are removed, but their
+	// content is kept.
+	Drop []string
+
+	// EscapeUnknown keeps elements that are not allowed as escaped text,
+	// e.g. "<foo>", instead of removing them.
+	EscapeUnknown bool
+}
+
+// DefaultSanitizePolicy allows common formatting, links, images, lists
+// and tables, with http, https and mailto URLs.  Scripts, styles,
+// forms and embedded content are dropped.
+func DefaultSanitizePolicy() *SanitizePolicy {
+	p := &SanitizePolicy{
+		Elements: map[string][]string{
+			"a":          {"href"},
+			"blockquote": {"cite"},
+			"img":        {"src", "alt", "width", "height"},
+			"ol":         {"start"},
+			"q":          {"cite"},
+			"td":         {"colspan", "rowspan"},
+			"th":         {"colspan", "rowspan", "scope"},
+			"time":       {"datetime"},
+		},
+		GlobalAttrs: []string{"class", "id", "title", "lang", "dir"},
+		URLAttrs:    []string{"href", "src", "cite"},
+		URLSchemes:  []string{"http", "https", "mailto"},
+		Drop: []string{
+			"script", "style", "iframe", "frame", "frameset", "object", "embed",
+			"applet", "form", "input", "button", "textarea", "select", "option",
+			"link", "meta", "base", "svg", "math", "template", "noscript",
+		},
+	}
+	for _, name := range []string{
+		"abbr", "article", "aside", "b", "br", "caption", "cite", "code",
+		"dd", "del", "details", "dfn", "div", "dl", "dt", "em", "figcaption",
+		"figure", "footer", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr",
+		"i", "ins", "kbd", "li", "mark", "p", "pre", "s", "samp", "section",
+		"small", "span", "strong", "sub", "summary", "sup", "table", "tbody",
+		"tfoot", "thead", "tr", "u", "ul", "var",
+	} {
+		if _, ok := p.Elements[name]; !ok {
+			p.Elements[name] = nil
+		}
+	}
+	return p
+}
+
+// SanitizedRenderer returns a renderer that sanitizes the tree and then
+// renders it with RenderHTMLFragment, e.g. for Engine.Render.
+func SanitizedRenderer(p *SanitizePolicy) func(io.Writer, *html.Node) error {
+	return func(w io.Writer, n *html.Node) error {
+		if err := p.Sanitize(n); err != nil {
+			return err
+		}
+		return RenderHTMLFragment(w, n)
+	}
+}
+
+var entityRegexp = regexp.MustCompile(`^&#?[a-zA-Z0-9]+;$`)
+
+// Sanitize removes everything not allowed by the policy from the
+// descendants of n.  The node n itself, usually the root, is not changed.
+//
+// Raw HTML is kept only if it is a single entity such as "&copy;",
+// otherwise it is converted to text.  Comments are removed.
+func (p *SanitizePolicy) Sanitize(n *html.Node) error {
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+		case html.RawNode:
+			if !entityRegexp.MatchString(c.Data) {
+				c.Type = html.TextNode
+			}
+		case html.ElementNode:
+			p.Sanitize(c)
+			p.element(c)
+		default:
+			n.RemoveChild(c)
+		}
+	}
+	return nil
+}
+
+// element sanitizes a single element whose children are already sanitized
+func (p *SanitizePolicy) element(n *html.Node) {
+	name := strings.ToLower(n.Data)
+	if contains(p.Drop, name) {
+		n.Parent.RemoveChild(n)
+		return
+	}
+	allowed, ok := p.Elements[name]
+	if !ok {
+		if p.EscapeUnknown {
+			sb := &strings.Builder{}
+			html.Render(sb, &html.Node{Type: html.ElementNode, Data: n.Data, Attr: n.Attr})
+			end := "</" + n.Data + ">"
+			n.InsertBefore(NewText(strings.TrimSuffix(sb.String(), end)), n.FirstChild)
+			n.AppendChild(NewText(end))
+		}
+		for c := n.FirstChild; c != nil; c = n.FirstChild {
+			n.RemoveChild(c)
+			n.Parent.InsertBefore(c, n)
+		}
+		n.Parent.RemoveChild(n)
+		return
+	}
+
+	n.Data = name
+	n.DataAtom = atom.Lookup([]byte(name))
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if !contains(allowed, key) && !contains(p.GlobalAttrs, key) {
+			continue
+		}
+		if contains(p.URLAttrs, key) && !p.allowedURL(attr.Val) {
+			continue
+		}
+		attr.Key = key
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+}
+
+// allowedURL checks the scheme of a URL.  Relative URLs are allowed.
+func (p *SanitizePolicy) allowedURL(u string) bool {
+	// browsers ignore whitespace and control characters in schemes
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, u)
+	idx := strings.IndexAny(u, ":/?#")
+	if idx == -1 || u[idx] != ':' {
+		return true
+	}
+	return contains(p.URLSchemes, strings.ToLower(u[:idx]))
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package tagfunctions
+
+import (
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	reg := NewRegistry().Register("ent", Entity)
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$b{bold} $i[class=x]{italic}", `<b>bold</b> <i class="x">italic</i>`},
+		{"$script{alert(1)}after", "after"},
+		{"$p[onclick=evil() style=x]{text}", "<p>text</p>"},
+		{"$a[href=https://x.org/ title=t]{ok}", `<a href="https://x.org/" title="t">ok</a>`},
+		{"$a[href=/relative#frag]{ok}", `<a href="/relative#frag">ok</a>`},
+		{"$a[href=javascript:alert(1)]{bad}", `<a>bad</a>`},
+		{"$a[href=' JaVa\tScRiPt:x']{bad}", `<a>bad</a>`},
+		{"$img[src=data:image/png;base64,xx alt=x]", `<img alt="x"/>`},
+		{"$unknown{kept $b{text}}", "kept <b>text</b>"},
+		{"$echo[1 2]{positional}", "positional"},
+		{"$ent[copy] $ent[#169]", "&copy; &#169;"},
+		{"$div{$iframe[src=x]{} $em{ok}}", "<div> <em>ok</em></div>"},
+	}
+	r := SanitizedRenderer(DefaultSanitizePolicy())
+	for i, tc := range tests {
+		e := Engine{Executor: Executor{Funcs: reg}, Render: r}
+		res, err := e.Process(tc.input)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		if res.Output != tc.want {
+			t.Errorf("case %d: got %s want %s", i, res.Output, tc.want)
+		}
+	}
+
+	p := DefaultSanitizePolicy()
+	p.EscapeUnknown = true
+	e := Engine{Post: []NodeFunc{p.Sanitize}}
+	res, err := e.Process("$blink[rate=2]{hi} $script{x}")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := `&lt;blink rate=&#34;2&#34;&gt;hi&lt;/blink&gt; `; res.Output != want {
+		t.Errorf("escape: got %s want %s", res.Output, want)
+	}
+}
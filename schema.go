@@ -0,0 +1,250 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ArgType is the expected type of an argument value
+type ArgType int
+
+const (
+	ArgString ArgType = iota // any value
+	ArgInt                   // base 10 integer
+	ArgFloat                 // floating point number
+	ArgBool                  // true/false, yes/no, on/off, 1/0
+	ArgEnum                  // one of ArgSpec.Enum
+	ArgURL                   // parsable absolute or relative URL
+)
+
+func (t ArgType) String() string {
+	switch t {
+	case ArgString:
+		return "string"
+	case ArgInt:
+		return "int"
+	case ArgFloat:
+		return "float"
+	case ArgBool:
+		return "bool"
+	case ArgEnum:
+		return "enum"
+	case ArgURL:
+		return "url"
+	}
+	return "unknown"
+}
+
+// ArgSpec describes a single argument
+type ArgSpec struct {
+	Name     string
+	Type     ArgType
+	Required bool
+	Enum     []string // allowed values when Type is ArgEnum
+}
+
+// BodyRule describes if a function accepts a body, i.e. $foo{body}
+type BodyRule int
+
+const (
+	BodyAny      BodyRule = iota // body is optional
+	BodyNone                     // body is not allowed
+	BodyRequired                 // body must be present
+)
+
+// Schema describes the arguments and body a function accepts.
+//
+// Positional arguments are those without a value, e.g. $img[photo.jpg],
+// and are matched in order with Args.  Named arguments have a value,
+// e.g. $img[width=100], and are matched by key with Named.
+type Schema struct {
+	Args  []ArgSpec // positional arguments, in order
+	Named []ArgSpec // named key=value arguments
+	Body  BodyRule
+
+	// AllowExtra accepts positional arguments beyond Args and
+	// named arguments not listed in Named.
+	AllowExtra bool
+}
+
+// WithSchema attaches an argument schema to a function.
+// The Executor validates nodes against it before calling the function.
+func WithSchema(s *Schema) Option {
+	return func(e *Entry) {
+		e.Schema = s
+	}
+}
+
+// Validate checks a node against the schema
+func (s *Schema) Validate(n *html.Node) error {
+	if s == nil {
+		return nil
+	}
+
+	pos := 0
+	seen := make(map[string]bool)
+	for _, attr := range n.Attr {
+		if attr.Val == "" {
+			// positional
+			if pos >= len(s.Args) {
+				if !s.AllowExtra {
+					return fmt.Errorf("unexpected argument %d %q, expected at most %d", pos+1, attr.Key, len(s.Args))
+				}
+				pos++
+				continue
+			}
+			if err := s.Args[pos].check(attr.Key); err != nil {
+				return fmt.Errorf("argument %d %q: %v", pos+1, s.Args[pos].Name, err)
+			}
+			pos++
+			continue
+		}
+
+		// named
+		spec := s.named(attr.Key)
+		if spec == nil {
+			if !s.AllowExtra {
+				return fmt.Errorf("unknown argument %q", attr.Key)
+			}
+			continue
+		}
+		if seen[attr.Key] {
+			return fmt.Errorf("argument %q: given more than once", attr.Key)
+		}
+		seen[attr.Key] = true
+		if err := spec.check(attr.Val); err != nil {
+			return fmt.Errorf("argument %q: %v", attr.Key, err)
+		}
+	}
+
+	for i := pos; i < len(s.Args); i++ {
+		if s.Args[i].Required {
+			return fmt.Errorf("argument %d %q: required", i+1, s.Args[i].Name)
+		}
+	}
+	for _, spec := range s.Named {
+		if spec.Required && !seen[spec.Name] {
+			return fmt.Errorf("argument %q: required", spec.Name)
+		}
+	}
+
+	switch s.Body {
+	case BodyNone:
+		if n.FirstChild != nil {
+			return fmt.Errorf("body not allowed")
+		}
+	case BodyRequired:
+		if n.FirstChild == nil {
+			return fmt.Errorf("body required")
+		}
+	}
+	return nil
+}
+
+// Usage returns a one line summary of the schema, e.g.
+//
+//	$img[src:url width=int] (no body)
+func (s *Schema) Usage(name string) string {
+	sb := strings.Builder{}
+	sb.WriteString("$" + name)
+	var args []string
+	for _, spec := range s.Args {
+		arg := spec.Name + ":" + spec.usageType()
+		if !spec.Required {
+			arg = "?" + arg
+		}
+		args = append(args, arg)
+	}
+	for _, spec := range s.Named {
+		arg := spec.Name + "=" + spec.usageType()
+		if !spec.Required {
+			arg = "?" + arg
+		}
+		args = append(args, arg)
+	}
+	if s.AllowExtra {
+		args = append(args, "...")
+	}
+	if len(args) > 0 {
+		sb.WriteString("[" + strings.Join(args, " ") + "]")
+	}
+	switch s.Body {
+	case BodyNone:
+		sb.WriteString(" (no body)")
+	case BodyRequired:
+		sb.WriteString("{...}")
+	}
+	return sb.String()
+}
+
+func (s *Schema) named(key string) *ArgSpec {
+	for i := range s.Named {
+		if s.Named[i].Name == key {
+			return &s.Named[i]
+		}
+	}
+	return nil
+}
+
+func (a *ArgSpec) usageType() string {
+	if a.Type == ArgEnum {
+		return strings.Join(a.Enum, "|")
+	}
+	return a.Type.String()
+}
+
+// check verifies a single value matches the spec
+func (a *ArgSpec) check(val string) error {
+	switch a.Type {
+	case ArgString:
+		return nil
+	case ArgInt:
+		if _, err := strconv.Atoi(val); err != nil {
+			return fmt.Errorf("expected int, got %q", val)
+		}
+	case ArgFloat:
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			return fmt.Errorf("expected float, got %q", val)
+		}
+	case ArgBool:
+		if _, err := parseBool(val); err != nil {
+			return err
+		}
+	case ArgEnum:
+		for _, e := range a.Enum {
+			if val == e {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s, got %q", strings.Join(a.Enum, ", "), val)
+	case ArgURL:
+		if val == "" {
+			return fmt.Errorf("expected url, got empty value")
+		}
+		if _, err := url.Parse(val); err != nil {
+			return fmt.Errorf("expected url, got %q", val)
+		}
+	default:
+		return fmt.Errorf("unknown argument type %d", a.Type)
+	}
+	return nil
+}
+
+// parseBool is strconv.ParseBool plus yes/no and on/off
+func parseBool(val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("expected bool, got %q", val)
+	}
+	return b, nil
+}
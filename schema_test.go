@@ -0,0 +1,62 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	img := &Schema{
+		Args: []ArgSpec{
+			{Name: "src", Type: ArgURL, Required: true},
+		},
+		Named: []ArgSpec{
+			{Name: "width", Type: ArgInt},
+			{Name: "lazy", Type: ArgBool},
+			{Name: "align", Type: ArgEnum, Enum: []string{"left", "right"}},
+		},
+		Body: BodyNone,
+	}
+
+	type test struct {
+		input string
+		want  string // expected error, empty if valid
+	}
+	tests := []test{
+		{"$img[photo.jpg]", ""},
+		{"$img[photo.jpg width=100 lazy=yes align=left]", ""},
+		{"$img", `argument 1 "src": required`},
+		{"$img[photo.jpg width=wide]", `argument "width": expected int, got "wide"`},
+		{"$img[photo.jpg lazy=maybe]", `argument "lazy": expected bool, got "maybe"`},
+		{"$img[photo.jpg align=center]", `argument "align": expected one of left, right, got "center"`},
+		{"$img[photo.jpg height=10]", `unknown argument "height"`},
+		{"$img[photo.jpg extra]", `unexpected argument 2 "extra", expected at most 1`},
+		{"$img[photo.jpg]{caption}", `body not allowed`},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		n := p.Parse(strings.NewReader(tc.input)).FirstChild
+		err := img.Validate(n)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			t.Errorf("case %d: %s: got %q want %q", i, tc.input, got, tc.want)
+		}
+	}
+
+	if got, want := img.Usage("img"), "$img[src:url ?width=int ?lazy=bool ?align=left|right] (no body)"; got != want {
+		t.Errorf("usage: got %q want %q", got, want)
+	}
+}
+
+func TestSchemaExecute(t *testing.T) {
+	reg := NewRegistry().Register("b", MakeTag("strong"), WithSchema(&Schema{Body: BodyRequired}))
+	if _, err := Generate("$b", reg); err == nil || err.Error() != "node b: body required" {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	if _, err := Generate("$b{ok}", reg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	templateHTML = reflect.TypeOf(template.HTML(""))
+)
+
+// TemplateFunc adapts a text/template or html/template function into a
+// NodeFunc.
+//
+// The node's positional arguments become the function's parameters,
+// converted to the parameter types as in BindArgs.  If the function
+// takes one more parameter than there are arguments, the text of the
+// body is used for the last one, so both $upper[hello] and $upper{hello}
+// work with strings.ToUpper.
+//
+// The node is replaced by the result: a template.HTML result is inserted
+// as raw HTML, anything else as text.  As with templates, the function may
+// return a second error value.
+func TemplateFunc(fn any) (NodeFunc, error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, fmt.Errorf("expected a function, got %T", fn)
+	}
+	switch {
+	case ft.NumOut() == 1:
+	case ft.NumOut() == 2 && ft.Out(1) == errorType:
+	default:
+		return nil, fmt.Errorf("function must return a value, or a value and an error")
+	}
+
+	return func(n *html.Node) error {
+		var args []string
+		for _, attr := range n.Attr {
+			if attr.Val != "" {
+				return fmt.Errorf("named argument %q not supported", attr.Key)
+			}
+			args = append(args, attr.Key)
+		}
+		if len(args) == ft.NumIn()-1 && !ft.IsVariadic() && n.FirstChild != nil {
+			args = append(args, TextContent(n))
+		}
+
+		in, err := templateArgs(ft, args)
+		if err != nil {
+			return err
+		}
+		out := fv.Call(in)
+		if len(out) == 2 && !out[1].IsNil() {
+			return out[1].Interface().(error)
+		}
+
+		RemoveChildren(n)
+		n.Attr = nil
+		n.DataAtom = 0
+		n.Type = html.TextNode
+		if out[0].Type() == templateHTML {
+			n.Type = html.RawNode
+			n.Data = out[0].String()
+			return nil
+		}
+		n.Data = FormatValue(out[0].Interface())
+		return nil
+	}, nil
+}
+
+// templateArgs converts string arguments to the function's parameters
+func templateArgs(ft reflect.Type, args []string) ([]reflect.Value, error) {
+	count := ft.NumIn()
+	if ft.IsVariadic() {
+		if len(args) < count-1 {
+			return nil, fmt.Errorf("expected at least %d arguments, got %d", count-1, len(args))
+		}
+	} else if len(args) != count {
+		return nil, fmt.Errorf("expected %d arguments, got %d", count, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var t reflect.Type
+		if ft.IsVariadic() && i >= count-1 {
+			t = ft.In(count - 1).Elem()
+		} else {
+			t = ft.In(i)
+		}
+		v := reflect.New(t).Elem()
+		if t.Kind() == reflect.Interface {
+			v.Set(reflect.ValueOf(arg))
+		} else if err := setField(v, arg); err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+// RegisterFuncMap adds every function from a text/template or
+// html/template FuncMap, see TemplateFunc.
+func (r *Registry) RegisterFuncMap(funcs map[string]any) error {
+	for name, fn := range funcs {
+		nf, err := TemplateFunc(fn)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		r.Register(name, nf)
+	}
+	return nil
+}
+
+// HTMLTemplateFunc returns an html/template function that converts a
+// tag function string into HTML, so documents can be embedded in
+// existing layouts:
+//
+//	funcs := template.FuncMap{"tagfunctions": HTMLTemplateFunc(reg)}
+//	...
+//	{{ tagfunctions .Body }}
+//
+// The result is returned as template.HTML, which html/template does not
+// escape, so it is first sanitized with DefaultSanitizePolicy: elements
+// such as $script and attributes such as onclick are removed.  Use
+// HTMLTemplateFuncPolicy to allow more for trusted documents.
+func HTMLTemplateFunc(reg *Registry) func(src string) (template.HTML, error) {
+	return HTMLTemplateFuncPolicy(reg, DefaultSanitizePolicy())
+}
+
+// HTMLTemplateFuncPolicy is HTMLTemplateFunc, sanitizing with the given
+// policy.  The policy must not be nil.
+func HTMLTemplateFuncPolicy(reg *Registry, p *SanitizePolicy) func(src string) (template.HTML, error) {
+	render := SanitizedRenderer(p)
+	return func(src string) (template.HTML, error) {
+		t := Tokenizer{}
+		n := t.Parse(strings.NewReader(src))
+		if err := Execute(n, reg); err != nil {
+			return "", err
+		}
+		sb := &strings.Builder{}
+		if err := render(sb, n); err != nil {
+			return "", err
+		}
+		return template.HTML(sb.String()), nil
+	}
+}
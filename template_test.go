@@ -0,0 +1,105 @@
+package tagfunctions
+
+import (
+	"errors"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFunc(t *testing.T) {
+	funcs := template.FuncMap{
+		"upper": strings.ToUpper,
+		"add":   func(a, b int) int { return a + b },
+		"join":  func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"star":  func() template.HTML { return "&#9733;" },
+		"fail":  func(s string) (string, error) { return "", errors.New("failed " + s) },
+	}
+	reg := NewRegistry()
+	if err := reg.RegisterFuncMap(funcs); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$upper[hello] $upper{world}", "HELLO WORLD"},
+		{"$add[1 2]", "3"},
+		{"$join[- a b c]", "a-b-c"},
+		{"$star", "&#9733;"},
+		{"$upper{<b>}", "&lt;B&gt;"},
+	}
+	for i, tc := range tests {
+		got, err := GenerateHTML(tc.input, reg)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("case %d: got %s want %s", i, got, tc.want)
+		}
+	}
+
+	errs := map[string]string{
+		"$add[1 x]":   `node add: argument 2: cannot convert "x" to int`,
+		"$add[1]":     "node add: expected 2 arguments, got 1",
+		"$fail[x]":    "node fail: failed x",
+		"$upper[a=b]": `node upper: named argument "a" not supported`,
+	}
+	for src, want := range errs {
+		if _, err := GenerateHTML(src, reg); err == nil || err.Error() != want {
+			t.Errorf("%s: got %v want %s", src, err, want)
+		}
+	}
+
+	if _, err := TemplateFunc("not a function"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestHTMLTemplateFunc(t *testing.T) {
+	reg := NewRegistry().Register("b", MakeTag("strong"))
+	tmpl := template.Must(template.New("page").
+		Funcs(template.FuncMap{"tagfunctions": HTMLTemplateFunc(reg)}).
+		Parse(`<div title="{{.Title}}">{{ tagfunctions .Body }}</div>`))
+
+	sb := &strings.Builder{}
+	data := map[string]string{
+		"Title": `"quoted"`,
+		"Body":  "$b{bold} & <script>",
+	}
+	if err := tmpl.Execute(sb, data); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := `<div title="&#34;quoted&#34;"><strong>bold</strong> &amp; &lt;script&gt;</div>`
+	if sb.String() != want {
+		t.Errorf("got %s want %s", sb.String(), want)
+	}
+
+	// functions and passed through tags are sanitized
+	sb.Reset()
+	data["Body"] = `$b{ok} $script{alert(1)} $a[href="javascript:x" onclick=x]{link}`
+	if err := tmpl.Execute(sb, data); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want = `<div title="&#34;quoted&#34;"><strong>ok</strong>  <a>link</a></div>`
+	if sb.String() != want {
+		t.Errorf("got %s want %s", sb.String(), want)
+	}
+}
+
+func TestHTMLTemplateFuncPolicy(t *testing.T) {
+	p := DefaultSanitizePolicy()
+	p.Elements["button"] = []string{"type"}
+	p.Drop = nil
+	fn := HTMLTemplateFuncPolicy(NewRegistry(), p)
+	got, err := fn("$button[type=submit onclick=x]{go}")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := `<button type="submit">go</button>`; string(got) != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
@@ -0,0 +1,202 @@
+package tagfunctions
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// TextFunc transforms a text node.
+//
+// It may change n.Data, or replace n with other nodes by inserting them
+// before n and removing n from its parent.  Nodes it inserts are not
+// executed again.
+type TextFunc func(n *html.Node) error
+
+// TextEntry is a registered text function
+type TextEntry struct {
+	Name string
+	Func TextFunc
+
+	// Skip lists element names; text inside any of them is not transformed.
+	Skip []string
+}
+
+// skipped returns true if any of the ancestors is excluded
+func (te *TextEntry) skipped(ancestors []string) bool {
+	for _, a := range ancestors {
+		for _, s := range te.Skip {
+			if a == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RegisterText adds or replaces a text function.
+//
+// Text functions are run on every text node, in the order they were
+// registered, before any function on the enclosing elements.  Text inside
+// any of the elements named in skip is left alone, e.g.
+//
+//	reg.RegisterText("quotes", TextReplacer(SmartQuotes), "code", "pre")
+//
+// Since ancestors have not yet been executed, skip uses the names as
+// written in the source.
+func (r *Registry) RegisterText(name string, fn TextFunc, skip ...string) *Registry {
+	r.addText(&TextEntry{
+		Name: name,
+		Func: fn,
+		Skip: skip,
+	})
+	return r
+}
+
+func (r *Registry) addText(te *TextEntry) {
+	for i, old := range r.text {
+		if old.Name == te.Name {
+			r.text[i] = te
+			return
+		}
+	}
+	r.text = append(r.text, te)
+}
+
+// TextFuncs returns all visible text functions in the order they run.
+// Parent functions run first, unless replaced by name in the overlay.
+func (r *Registry) TextFuncs() []*TextEntry {
+	if r == nil {
+		return nil
+	}
+	out := r.parent.TextFuncs()
+	for _, te := range r.text {
+		replaced := false
+		for i, old := range out {
+			if old.Name == te.Name {
+				out[i] = te
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			out = append(out, te)
+		}
+	}
+	return out
+}
+
+// TextReplacer adapts a string transformation into a TextFunc
+func TextReplacer(fn func(string) string) TextFunc {
+	return func(n *html.Node) error {
+		n.Data = fn(n.Data)
+		return nil
+	}
+}
+
+// SmartQuotes converts straight quotes into curly quotes.
+//
+// A quote at the start of the text, or after whitespace or an opening
+// bracket, is an opening quote.  All others are closing quotes, which
+// also makes apostrophes in "don't" correct.
+func SmartQuotes(s string) string {
+	if !strings.ContainsAny(s, `"'`) {
+		return s
+	}
+	sb := strings.Builder{}
+	var prev rune = ' '
+	for _, r := range s {
+		opening := strings.ContainsRune(" \t\r\n([{\u00a0", prev)
+		switch {
+		case r == '"' && opening:
+			sb.WriteRune('“')
+		case r == '"':
+			sb.WriteRune('”')
+		case r == '\'' && opening:
+			sb.WriteRune('‘')
+		case r == '\'':
+			sb.WriteRune('’')
+		default:
+			sb.WriteRune(r)
+		}
+		prev = r
+	}
+	return sb.String()
+}
+
+var dashReplacer = strings.NewReplacer("---", "—", "--", "–")
+
+// Dashes converts "---" to an em dash and "--" to an en dash
+func Dashes(s string) string {
+	return dashReplacer.Replace(s)
+}
+
+var unitRegexp = regexp.MustCompile(`(\d) +(%|°[CF]|(?:[kMGT]?B|[kmcµn]?m|[km]?g|[kM]?Hz|ms|s|min|h|px|pt|em|rem|kW|W|V|A|mph|kph)\b)`)
+
+// NonBreakingUnits replaces the space between a number and a unit with
+// a non-breaking space, e.g. "10 kg" so it never wraps between lines.
+func NonBreakingUnits(s string) string {
+	return unitRegexp.ReplaceAllString(s, "$1\u00a0$2")
+}
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// AutoLink converts URLs in text into links.
+//
+// Trailing punctuation is not considered part of the URL.  Since this
+// replaces the text node, it should be registered after any text
+// functions that only change the text.
+func AutoLink(n *html.Node) error {
+	matches := urlRegexp.FindAllStringIndex(n.Data, -1)
+	if len(matches) == 0 || n.Parent == nil {
+		return nil
+	}
+	text := n.Data
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		end = start + len(strings.TrimRight(text[start:end], ".,;:!?)]}'"))
+		if start > last {
+			n.Parent.InsertBefore(NewText(text[last:start]), n)
+		}
+		u := text[start:end]
+		n.Parent.InsertBefore(Append(NewElement("a", "href", u), NewText(u)), n)
+		last = end
+	}
+	if last < len(text) {
+		n.Parent.InsertBefore(NewText(text[last:]), n)
+	}
+	n.Parent.RemoveChild(n)
+	return nil
+}
+
+// DefaultEmoji is a small set of common emoji shortcodes
+var DefaultEmoji = map[string]string{
+	"check":    "✅",
+	"heart":    "❤️",
+	"rocket":   "\U0001f680",
+	"smile":    "\U0001f604",
+	"tada":     "\U0001f389",
+	"thumbsup": "\U0001f44d",
+	"warning":  "⚠️",
+	"x":        "❌",
+}
+
+var emojiRegexp = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+
+// Emoji returns a text function that replaces shortcodes such as :smile:
+// using the given table.  Unknown shortcodes are left alone.
+func Emoji(table map[string]string) TextFunc {
+	return TextReplacer(func(s string) string {
+		if !strings.Contains(s, ":") {
+			return s
+		}
+		return emojiRegexp.ReplaceAllStringFunc(s, func(code string) string {
+			if e, ok := table[code[1:len(code)-1]]; ok {
+				return e
+			}
+			return code
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package tagfunctions
+
+import (
+	"testing"
+)
+
+func TestTextFunctions(t *testing.T) {
+	type test struct {
+		fn    func(string) string
+		input string
+		want  string
+	}
+	tests := []test{
+		{SmartQuotes, `"Hello," she said. Don't 'go'`, "“Hello,” she said. Don’t ‘go’"},
+		{SmartQuotes, `("quoted")`, "(“quoted”)"},
+		{Dashes, "a -- b --- c", "a – b — c"},
+		{NonBreakingUnits, "10 kg and 5 ms and 3 apples and 50 %", "10\u00a0kg and 5\u00a0ms and 3 apples and 50\u00a0%"},
+	}
+	for i, tc := range tests {
+		if got := tc.fn(tc.input); got != tc.want {
+			t.Errorf("case %d: got %q want %q", i, got, tc.want)
+		}
+	}
+}
+
+func TestTextExecute(t *testing.T) {
+	reg := NewRegistry().
+		Register("code", MakeTag("code")).
+		RegisterText("quotes", TextReplacer(SmartQuotes), "code", "pre").
+		RegisterText("emoji", Emoji(DefaultEmoji), "code").
+		RegisterText("autolink", AutoLink, "code", "a")
+
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{`"hi" :smile:`, "“hi” \U0001f604"},
+		{`$code{"hi" :smile:}`, `<code>&#34;hi&#34; :smile:</code>`},
+		{`$b{$pre{"x"} "y"}`, "<b><pre>&#34;x&#34;</pre> “y”</b>"},
+		{`see https://example.com/a. or $code{http://x.org}`, `see <a href="https://example.com/a">https://example.com/a</a>. or <code>http://x.org</code>`},
+	}
+	for i, tc := range tests {
+		got, err := GenerateHTML(tc.input, reg)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if got != tc.want {
+			t.Errorf("case %d: got %s want %s", i, got, tc.want)
+		}
+	}
+
+	// overlay replaces by name but keeps order
+	doc := reg.Overlay().RegisterText("quotes", TextReplacer(Dashes))
+	if got := doc.TextFuncs(); len(got) != 3 || got[0].Name != "quotes" {
+		t.Errorf("unexpected text functions %v", got)
+	}
+}
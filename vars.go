@@ -0,0 +1,209 @@
+package tagfunctions
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// UndefinedPolicy controls what happens when a variable is not defined
+type UndefinedPolicy int
+
+const (
+	UndefinedError  UndefinedPolicy = iota // the function fails
+	UndefinedWarn                          // empty value, and a warning is recorded
+	UndefinedIgnore                        // empty value
+)
+
+// Var looks up a variable.
+//
+// Variables set in the document are checked first, innermost first, then
+// Executor.Vars, then Executor.FrontMatter.  So a value in Vars
+// replaces the front matter value of the same name, which lets the
+// program override a document's defaults.  Dotted names such as
+// "product.name" look inside maps, structs and slices.
+func (ctx *Context) Var(name string) (any, bool) {
+	first, rest, _ := strings.Cut(name, ".")
+	v, ok := ctx.root(first)
+	if !ok {
+		return nil, false
+	}
+	if rest == "" {
+		return v, true
+	}
+	return lookupPath(v, strings.Split(rest, "."))
+}
+
+// root finds the first part of a variable name
+func (ctx *Context) root(name string) (any, bool) {
+	for s := ctx.ex.scope; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	if v, ok := ctx.ex.Vars[name]; ok {
+		return v, true
+	}
+	v, ok := ctx.ex.FrontMatter[name]
+	return v, ok
+}
+
+// SetVar sets a variable that is visible from n until the end of n's parent
+func (ctx *Context) SetVar(n *html.Node, name string, value any) {
+	ctx.localScope(n).vars[name] = value
+}
+
+// Warn records a problem that does not stop execution
+func (ctx *Context) Warn(err error) {
+	ctx.ex.warnings = append(ctx.ex.warnings, err)
+}
+
+// undefined applies the undefined variable policy
+func (ctx *Context) undefined(name string) error {
+	err := fmt.Errorf("undefined variable %q", name)
+	switch ctx.ex.Undefined {
+	case UndefinedWarn:
+		ctx.Warn(err)
+	case UndefinedIgnore:
+	default:
+		return err
+	}
+	return nil
+}
+
+// lookupPath follows a path into maps, structs and slices
+func lookupPath(v any, path []string) (any, bool) {
+	rv := reflect.ValueOf(v)
+	for _, key := range path {
+		for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+			if rv.IsNil() {
+				return nil, false
+			}
+			rv = rv.Elem()
+		}
+		switch rv.Kind() {
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			rv = rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+			if !rv.IsValid() {
+				return nil, false
+			}
+		case reflect.Struct:
+			f := rv.FieldByNameFunc(func(s string) bool {
+				return strings.EqualFold(s, key)
+			})
+			if !f.IsValid() || !f.CanInterface() {
+				return nil, false
+			}
+			rv = f
+		case reflect.Slice, reflect.Array:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= rv.Len() {
+				return nil, false
+			}
+			rv = rv.Index(i)
+		default:
+			return nil, false
+		}
+	}
+	return rv.Interface(), true
+}
+
+// FormatValue converts a variable into text
+func FormatValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []string:
+		return strings.Join(x, ", ")
+	case fmt.Stringer:
+		return x.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// Set is the $set function, which sets variables for the rest of the
+// enclosing element:
+//
+//	$set[version=1.4.2 product="Tag Functions"]
+//	$set[title]{The $b{Best} Title}
+//
+// With a single name and a body, the variable is the text of the body.
+func Set(ctx *Context, n *html.Node) error {
+	if len(n.Attr) == 0 {
+		return fmt.Errorf("missing variable name")
+	}
+	if len(n.Attr) == 1 && n.Attr[0].Val == "" {
+		ctx.SetVar(n, n.Attr[0].Key, TextContent(n))
+	} else {
+		for _, attr := range n.Attr {
+			if attr.Val == "" {
+				return fmt.Errorf("variable %q has no value", attr.Key)
+			}
+			ctx.SetVar(n, attr.Key, attr.Val)
+		}
+	}
+	if n.Parent != nil {
+		n.Parent.RemoveChild(n)
+	}
+	return nil
+}
+
+// Get is the $get function, which is replaced by the value of a variable:
+//
+//	$get[version]
+//	$get[version default=dev]
+//	$get[product.name]
+//
+// Undefined variables without a default are handled according to
+// Executor.Undefined.
+func Get(ctx *Context, n *html.Node) error {
+	name := GetArg(n, 0)
+	if name == "" || n.Attr[0].Val != "" {
+		return fmt.Errorf("missing variable name")
+	}
+	return replaceVar(ctx, n, name)
+}
+
+// VarFunc is the $var function, which is $get with the name as the body:
+//
+//	$var{version}
+func VarFunc(ctx *Context, n *html.Node) error {
+	name := strings.TrimSpace(TextContent(n))
+	if name == "" {
+		return fmt.Errorf("missing variable name")
+	}
+	return replaceVar(ctx, n, name)
+}
+
+// replaceVar turns n into a text node with the value of the variable
+func replaceVar(ctx *Context, n *html.Node, name string) error {
+	v, ok := ctx.Var(name)
+	if !ok {
+		def, hasDefault := "", false
+		for _, attr := range n.Attr {
+			if attr.Key == "default" {
+				def, hasDefault = attr.Val, true
+			}
+		}
+		if !hasDefault {
+			if err := ctx.undefined(name); err != nil {
+				return err
+			}
+		}
+		v = def
+	}
+	RemoveChildren(n)
+	n.Type = html.TextNode
+	n.Data = FormatValue(v)
+	n.DataAtom = 0
+	n.Attr = nil
+	return nil
+}
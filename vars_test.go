@@ -0,0 +1,79 @@
+package tagfunctions
+
+import (
+	"strings"
+	"testing"
+)
+
+type product struct {
+	Name     string
+	Versions []string
+}
+
+func TestVariables(t *testing.T) {
+	reg := Builtins()
+	vars := map[string]any{
+		"site":    "example.com",
+		"product": product{Name: "Gopher", Versions: []string{"1.0", "2.0"}},
+		"links":   map[string]string{"home": "/"},
+	}
+
+	type test struct {
+		input string
+		want  string
+	}
+	tests := []test{
+		{"$set[version=1.4.2]v$get[version]", "v1.4.2"},
+		{"$set[a=1 b=2]$get[a]$var{b}", "12"},
+		{"$set[title]{The $var{site} Title}$get[title]", "The example.com Title"},
+		{"$get[site] $get[product.name] $get[product.versions.1] $get[links.home]", "example.com Gopher 2.0 /"},
+		{"$get[version default=dev]", "dev"},
+		{"$set[version=1]$get[version default=dev]", "1"},
+		{"$set[site=local]$get[site]", "local"},
+		// variables are visible until the end of the enclosing element
+		{"$div{$set[x=inner]$get[x]} $get[x default=outer]", "<div>inner</div> outer"},
+		// and can be used in macros
+		{"$define[v]{version $get[version]}$set[version=3]$v", "version 3"},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		n := p.Parse(strings.NewReader(tc.input))
+		ex := Executor{Funcs: reg, Vars: vars}
+		if err := ex.Execute(n); err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		sb := &strings.Builder{}
+		RenderHTML(sb, n)
+		if want := "<root>" + tc.want + "</root>"; sb.String() != want {
+			t.Errorf("case %d: got %s want %s", i, sb.String(), want)
+		}
+	}
+}
+
+func TestUndefinedVariables(t *testing.T) {
+	src := "[$get[missing]] [$get[product.nope]]"
+
+	p := Tokenizer{}
+	ex := Executor{Funcs: Builtins()}
+	if err := ex.Execute(p.Parse(strings.NewReader(src))); err == nil || err.Error() != `node get: undefined variable "missing"` {
+		t.Errorf("expected undefined error, got %v", err)
+	}
+
+	ex.Undefined = UndefinedWarn
+	n := p.Parse(strings.NewReader(src))
+	if err := ex.Execute(n); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := TextContent(n); got != "[] []" {
+		t.Errorf("got %q", got)
+	}
+	if len(ex.Warnings()) != 2 {
+		t.Errorf("expected 2 warnings, got %v", ex.Warnings())
+	}
+
+	ex.Undefined = UndefinedIgnore
+	if err := ex.Execute(p.Parse(strings.NewReader(src))); err != nil || len(ex.Warnings()) != 0 {
+		t.Errorf("expected no error or warnings, got %v %v", err, ex.Warnings())
+	}
+}
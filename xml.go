@@ -0,0 +1,165 @@
+package tagfunctions
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// XMLRenderer renders an executed tree as well-formed XML
+type XMLRenderer struct {
+	// Prefix, if set, is added to the names of unknown elements,
+	// as in "prefix:name".  It is ignored unless Namespace is set,
+	// since an undeclared prefix is not well-formed.
+	Prefix string
+
+	// Namespace is declared for Prefix on the top element.
+	Namespace string
+
+	// IsKnown returns true for elements that are not prefixed.
+	// If nil, the standard HTML elements are known.
+	IsKnown func(*html.Node) bool
+}
+
+// RenderXML renders n as XML with no namespace prefix.
+// See XMLRenderer.Render.
+func RenderXML(w io.Writer, n *html.Node) error {
+	return (&XMLRenderer{}).Render(w, n)
+}
+
+// Render writes n as XML.
+//
+// Text is escaped and elements with no children are self-closing.
+// Positional args become attributes named by their index, so
+// $echo[1 2] is <echo arg0="1" arg1="2"/>, matching GetArg.  Other names
+// that are not valid in XML have the bad characters replaced with '_'.
+// Raw nodes, such as from Entity, are decoded as HTML and escaped.
+// The root made by Parse is never prefixed.
+func (xr *XMLRenderer) Render(w io.Writer, n *html.Node) error {
+	buf := bufio.NewWriter(w)
+	if err := xr.render(buf, n, true); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+func (xr *XMLRenderer) render(w *bufio.Writer, n *html.Node, top bool) error {
+	switch n.Type {
+	case html.TextNode:
+		_, err := w.WriteString(escapeXML(n.Data))
+		return err
+	case html.RawNode:
+		_, err := w.WriteString(escapeXML(html.UnescapeString(n.Data)))
+		return err
+	case html.CommentNode:
+		// "--" is not allowed in a comment
+		data := strings.ReplaceAll(n.Data, "--", "- -")
+		if strings.HasSuffix(data, "-") {
+			data += " "
+		}
+		_, err := w.WriteString("<!--" + data + "-->")
+		return err
+	case html.ElementNode:
+		// below
+	default:
+		return fmt.Errorf("xml: unsupported node type %d", n.Type)
+	}
+
+	name := xr.name(n, top)
+	w.WriteString("<" + name)
+	if top && xr.prefixed() {
+		fmt.Fprintf(w, ` xmlns:%s="%s"`, xmlName(xr.Prefix), escapeXML(xr.Namespace))
+	}
+	seen := map[string]bool{}
+	for i, a := range n.Attr {
+		key, val := a.Key, a.Val
+		if val == "" {
+			key, val = fmt.Sprintf("arg%d", i), a.Key
+		}
+		key = xmlName(key)
+		if seen[key] {
+			// duplicate attributes are not allowed
+			continue
+		}
+		seen[key] = true
+		w.WriteString(" " + key + `="` + escapeXML(val) + `"`)
+	}
+	if n.FirstChild == nil {
+		_, err := w.WriteString("/>")
+		return err
+	}
+	w.WriteByte('>')
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := xr.render(w, c, false); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString("</" + name + ">")
+	return err
+}
+
+// prefixed returns true if unknown elements get a prefix
+func (xr *XMLRenderer) prefixed() bool {
+	return xr.Prefix != "" && xr.Namespace != ""
+}
+
+// name returns the element name, prefixed if unknown
+func (xr *XMLRenderer) name(n *html.Node, top bool) string {
+	name := xmlName(n.Data)
+	if !xr.prefixed() || top && n.Parent == nil && n.Data == "root" {
+		return name
+	}
+	known := atom.Lookup([]byte(n.Data)) != 0
+	if xr.IsKnown != nil {
+		known = xr.IsKnown(n)
+	}
+	if known {
+		return name
+	}
+	return xmlName(xr.Prefix) + ":" + name
+}
+
+// xmlName makes s a valid XML name, without a namespace prefix
+func xmlName(s string) string {
+	if s == "" {
+		return "_"
+	}
+	out := []rune(s)
+	for i, r := range out {
+		ok := r == '_' || unicode.IsLetter(r)
+		if i > 0 {
+			ok = ok || r == '-' || r == '.' || unicode.IsDigit(r)
+		}
+		if !ok {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
+
+var xmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"\r", "&#xD;",
+)
+
+// escapeXML escapes text and removes characters not allowed in XML
+func escapeXML(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20, r == 0xFFFE, r == 0xFFFF:
+			return -1
+		}
+		return r
+	}, s)
+	return xmlEscaper.Replace(s)
+}
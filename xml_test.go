@@ -0,0 +1,111 @@
+package tagfunctions
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// wellFormed checks the output with the standard XML decoder
+func wellFormed(t *testing.T, doc string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Errorf("not well-formed: %v: %s", err, doc)
+			return
+		}
+	}
+}
+
+func TestRenderXML(t *testing.T) {
+	type test struct {
+		input string
+		want  string
+	}
+
+	tests := []test{
+		{"", "<root/>"},
+		{"$b{bold} text", "<root><b>bold</b> text</root>"},
+		{"$echo[1 2]", `<root><echo arg0="1" arg1="2"/></root>`},
+		{"$p[class=x]{a < b & c}", `<root><p class="x">a &lt; b &amp; c</p></root>`},
+		{`$p[title='say "hi"']{x}`, `<root><p title="say &quot;hi&quot;">x</p></root>`},
+		{"$p[a:b=1 2x=2 a=1 a=2]{x}", `<root><p a_b="1" _x="2" a="1">x</p></root>`},
+		{"$br", "<root><br/></root>"},
+		{"$p{a $entity[copy] b}", "<root><p>a © b</p></root>"},
+		{"$my.tag{x}", "<root><my.tag>x</my.tag></root>"},
+	}
+	for i, tc := range tests {
+		p := Tokenizer{}
+		node := p.Parse(strings.NewReader(tc.input))
+		if err := Execute(node, NewRegistry().Register("entity", Entity)); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		sb := strings.Builder{}
+		if err := RenderXML(&sb, node); err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if got := sb.String(); got != tc.want {
+			t.Errorf("case %d: %q: expected %q, got %q", i, tc.input, tc.want, got)
+		}
+		wellFormed(t, sb.String())
+	}
+}
+
+func TestXMLRendererPrefix(t *testing.T) {
+	xr := &XMLRenderer{Prefix: "tf", Namespace: "urn:x-tagfunctions"}
+	p := Tokenizer{}
+	node := p.Parse(strings.NewReader("$p{$note[1]{x} $b{y}}"))
+	sb := strings.Builder{}
+	if err := xr.Render(&sb, node); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := `<root xmlns:tf="urn:x-tagfunctions"><p><tf:note arg0="1">x</tf:note> <b>y</b></p></root>`
+	if sb.String() != want {
+		t.Errorf("expected %s, got %s", want, sb.String())
+	}
+	wellFormed(t, sb.String())
+
+	// custom known elements
+	xr.IsKnown = func(n *html.Node) bool { return n.Data == "note" }
+	sb.Reset()
+	if err := xr.Render(&sb, node.FirstChild.FirstChild); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want = `<note xmlns:tf="urn:x-tagfunctions" arg0="1">x</note>`
+	if sb.String() != want {
+		t.Errorf("expected %s, got %s", want, sb.String())
+	}
+
+	// a prefix without a namespace is ignored
+	xr = &XMLRenderer{Prefix: "tf"}
+	sb.Reset()
+	if err := xr.Render(&sb, node); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want = `<root><p><note arg0="1">x</note> <b>y</b></p></root>`
+	if sb.String() != want {
+		t.Errorf("expected %s, got %s", want, sb.String())
+	}
+	wellFormed(t, sb.String())
+}
+
+func TestRenderXMLComment(t *testing.T) {
+	n := &html.Node{Type: html.CommentNode, Data: "a -- b-"}
+	root := Append(NewElement("root"), n, NewText("\x01ok"))
+	sb := strings.Builder{}
+	if err := RenderXML(&sb, root); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "<root><!--a - - b- -->ok</root>"; sb.String() != want {
+		t.Errorf("expected %q, got %q", want, sb.String())
+	}
+	wellFormed(t, sb.String())
+}